@@ -20,6 +20,7 @@ type CPUConfig struct {
 	CacheReplacement string     `json:"cache_replacement"`
 	CacheDelay       int        `json:"cache_delay"`
 	LogLevel         slog.Level `json:"log_level"`
+	ClockMode        string     `json:"clock_mode"`
 }
 
 type PaginationConfig struct {
@@ -30,6 +31,7 @@ type PaginationConfig struct {
 
 type PCBS struct {
 	PID int
+	TID int // hilo del proceso que se ejecuta, 0 es el principal
 	PC  int
 	ME  []int
 	MT  []int
@@ -50,11 +52,13 @@ type RequestPayload struct {
 
 type KernelResponse struct {
 	PID int `json:"pid"`
+	TID int `json:"tid"`
 	PC  int `json:"pc"`
 }
 
 type DispatchResponse struct {
 	PID    int    `json:"pid"`
+	TID    int    `json:"tid"`
 	PC     int    `json:"pc"`
 	Motivo string `json:"motivo"`
 }
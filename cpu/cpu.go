@@ -10,9 +10,11 @@ import (
 	"os"
 	"ssoo-cpu/config"
 	cache "ssoo-cpu/memory"
+	"ssoo-utils/clock"
 	"ssoo-utils/codeutils"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"ssoo-utils/parsers"
 	"strconv"
 	"time"
@@ -30,6 +32,11 @@ var status = 0
 
 var fetch = false
 
+var (
+	dispatches   = metrics.NewCounter("ssoo_cpu_dispatches_total", "Procesos recibidos del kernel para ejecutar.")
+	instructions = metrics.NewCounterVec("ssoo_cpu_instructions_total", "Instrucciones ejecutadas por tipo.", "instruction")
+)
+
 func main() {
 	//Obtener identificador
 	if len(os.Args) < 2 {
@@ -50,6 +57,12 @@ func main() {
 	fmt.Printf("Config Loaded:\n%s", parsers.Struct(config.Values))
 	config.Values.PortCPU += identificador
 
+	err := clock.Setup(config.Values.ClockMode, fmt.Sprintf("%s:%d", config.Values.IpKernel, config.Values.PortKernel))
+	if err != nil {
+		fmt.Printf("Error configurando el reloj: %v\n", err)
+		return
+	}
+
 	if config.Values.CacheEntries != 0 {
 		config.CacheEnable = true
 		cache.InitCache()
@@ -62,7 +75,7 @@ func main() {
 		Port:     config.Values.PortKernel,
 		Endpoint: "/ping",
 	})
-	_, err := http.Get(kernelPing)
+	_, err = http.Get(kernelPing)
 	if err != nil {
 		fmt.Println("Esperando a Kernel")
 	}
@@ -106,6 +119,7 @@ func main() {
 
 	mux.Handle("/interrupt", interrupt())
 	mux.Handle("/dispatch", receivePIDPC())
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTeapot)
 		go func() {
@@ -122,6 +136,8 @@ func main() {
 	select {}
 }
 
+// ciclo ejecuta el proceso recibido. El kernel toma un trabajo del reloj al despacharlo: se suelta cuando
+// el proceso deja la CPU o, si lo saca una interrupción, pasa a quien interrumpió.
 func ciclo() {
 	fetch = false
 	config.Instruccion = ""
@@ -153,15 +169,17 @@ func ciclo() {
 			return
 		case <-config.ExitChan:
 			sendResults(config.Pcb.PID, config.Pcb.PC, "Exit")
+			clock.Release()
 			return
 		default:
 		}
 
 		if status == -1 {
+			clock.Release()
 			return
 		}
 
-		time.Sleep(100 * time.Millisecond)
+		clock.Sleep(100 * time.Millisecond)
 	}
 }
 
@@ -180,6 +198,7 @@ func sendPidPcToMemory(PC int, PID int) bool{
 		Endpoint: "process",
 		Queries: map[string]string{
 			"pid": fmt.Sprint(PID),
+			"tid": fmt.Sprint(config.Pcb.TID),
 			"pc":  fmt.Sprint(PC),
 		},
 	})
@@ -217,6 +236,7 @@ func exec() int {
 
 	status = 0
 	bloqueante = false
+	instructions.With(config.Instruccion).Inc()
 
 	switch config.Instruccion {
 	case "NOOP":
@@ -264,6 +284,24 @@ func exec() int {
 
 		status = sendIO()
 
+	case "IO_STDOUT", "IO_STDIN":
+		//mueve arg3 bytes entre la dirección lógica arg2 y el dispositivo arg1, el proceso deja la CPU como en IO
+		//la cache se baja antes (ver sendIO) porque el dispositivo lee y escribe la memoria del proceso
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str + "-" + fmt.Sprint(config.Exec_values.Arg1) + "-" + fmt.Sprint(config.Exec_values.Arg2),
+		})
+		status = sendIO()
+
+	case "F_CREATE", "F_OPEN", "F_WRITE", "F_READ", "F_TRUNCATE", "F_DELETE":
+		//operación sobre el archivo arg1, la atiende el filesystem como una IO y el proceso deja la CPU
+		//la cache se baja antes (ver sendIO) porque el filesystem lee y escribe la memoria del proceso
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + fmt.Sprint(instruction.Args),
+		})
+		status = sendIO()
+
 	case "INIT_PROC":
 		//inicia un proceso con el arg1 como el arch de instrc. y el arg2 como el tamaño
 
@@ -282,6 +320,97 @@ func exec() int {
 		})
 		status = dumpMemory()
 
+	case "WAIT", "SIGNAL":
+		//toma o devuelve una instancia del recurso arg1, con WAIT puede quedar bloqueado
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str,
+		})
+		status = sendMayBlock()
+
+	case "THREAD_CREATE":
+		//crea un hilo del proceso con el arch de instrc. arg1 y la prioridad arg2, opcional
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str + "-" + fmt.Sprint(config.Exec_values.Arg1),
+		})
+		//desde acá las páginas del proceso son compartidas, se bajan la cache y la TLB y memoria las marca
+		cache.EndProcess(config.Pcb.PID)
+		cache.FlushTLB(config.Pcb.PID)
+		status = initProcess()
+		config.Pcb.PC++
+
+	case "THREAD_JOIN":
+		//espera a que termine el hilo arg1 del proceso
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + fmt.Sprint(config.Exec_values.Arg1),
+		})
+		status = sendMayBlock()
+
+	case "THREAD_EXIT":
+		//fin del hilo, el proceso sigue mientras tenga otros hilos
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion,
+			"TID":        fmt.Sprint(config.Pcb.TID),
+		})
+		status = sendMayBlock()
+
+	case "MSG_SEND", "MSG_RECV":
+		//manda o recibe por la cola arg1 los arg3 bytes desde la dirección lógica arg2, MSG_RECV puede quedar bloqueado
+		//la cache se baja antes (ver sendMayBlock) porque el kernel lee y escribe la memoria del proceso
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str + "-" + fmt.Sprint(config.Exec_values.Arg1) + "-" + fmt.Sprint(config.Exec_values.Arg2),
+		})
+		status = sendMayBlock()
+
+	case "SHM_ATTACH":
+		//mapea el segmento compartido arg1 de arg2 bytes, creándolo si no existe
+		//si hay destino el kernel escribe ahí la dirección del segmento
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str + "-" + fmt.Sprint(config.Exec_values.Arg1),
+		})
+		status = sendMayBlock()
+
+	case "SHM_DETACH":
+		//desmapea el segmento compartido arg1, las entradas de la TLB del proceso pueden apuntar a sus marcos
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str,
+		})
+		cache.FlushTLB(config.Pcb.PID)
+		status = sendMayBlock()
+
+	case "MALLOC":
+		//agrega arg1 bytes al final del espacio de direcciones, puede quedar bloqueado esperando memoria
+		//si hay destino el kernel escribe ahí la dirección asignada, sendMayBlock ya bajó la cache
+		//la tabla de páginas cambia, se sacan las entradas del proceso de la TLB
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + fmt.Sprint(config.Exec_values.Arg1),
+		})
+		cache.FlushTLB(config.Pcb.PID)
+		status = sendMayBlock()
+
+	case "SLEEP":
+		//bloquea el proceso arg1 ms con un timer del kernel, sin pasar por una IO
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + fmt.Sprint(config.Exec_values.Arg1),
+		})
+		status = sendMayBlock()
+
+	case "WAIT_CHILD":
+		//espera a que termine el hijo arg1, o cualquier hijo si no hay argumento
+
+		logger.RequiredLog(true, uint(config.Pcb.PID), "", map[string]string{
+			"Ejecutando": config.Instruccion + "-" + config.Exec_values.Str,
+		})
+		status = sendMayBlock()
+
 	case "EXIT":
 		//fin de proceso
 
@@ -359,6 +488,33 @@ func sendIO() int {
 	return -1
 }
 
+// sendMayBlock envía una syscall después de la cual el kernel puede sacar al proceso de la CPU.
+func sendMayBlock() int {
+
+	config.Pcb.PC++ // Incrementar PC antes de enviar la syscall
+
+	// El kernel puede bloquear o finalizar el proceso, la cache se baja antes como en IO
+	cache.EndProcess(config.Pcb.PID)
+
+	resp, err := sendSyscall("syscall", instruction)
+	if err != nil {
+		slog.Error("Error en syscall "+config.Instruccion, "error", err)
+		return -1
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return 0
+	case http.StatusAccepted:
+		// El kernel bloqueó o finalizó el proceso, deja la CPU
+		return -1
+	default:
+		slog.Error("Kernel respondió con error la syscall "+config.Instruccion, "status", resp.StatusCode)
+		return -1
+	}
+}
+
 func DeleteProcess(pid int) int {
 
 	cache.EndProcess(pid)
@@ -454,10 +610,13 @@ func receivePIDPC() http.HandlerFunc {
 			return
 		}
 
-		slog.Info("Recibido desde Kernel", "PID", req.PID, " PC", req.PC)
+		slog.Info("Recibido desde Kernel", "PID", req.PID, "TID", req.TID, " PC", req.PC)
+
+		dispatches.Inc()
 
 		// Guardar la info en config global
 		config.Pcb.PID = req.PID
+		config.Pcb.TID = req.TID
 		config.Pcb.PC = req.PC
 
 		// Iniciar ciclo
@@ -561,10 +720,37 @@ func asign() {
 		config.Exec_values.Str = instruction.Args[0]
 		config.Exec_values.Arg1 = tiempo
 
+	case codeutils.IO_STDOUT, codeutils.IO_STDIN:
+		config.Instruccion = codeutils.OpcodeStrings[instruction.Opcode]
+		if len(instruction.Args) != 3 {
+			slog.Error(config.Instruccion + " requiere 3 argumentos")
+			break
+		}
+		direccion, err := strconv.Atoi(instruction.Args[1])
+		if err != nil {
+			slog.Error("error convirtiendo Direccion en "+config.Instruccion, "error", err)
+		}
+		tamanio, err := strconv.Atoi(instruction.Args[2])
+		if err != nil {
+			slog.Error("error convirtiendo Tamaño en "+config.Instruccion, "error", err)
+		}
+		config.Exec_values.Str = instruction.Args[0]
+		config.Exec_values.Arg1 = direccion
+		config.Exec_values.Arg2 = tamanio
+
+	case codeutils.F_CREATE, codeutils.F_OPEN, codeutils.F_WRITE, codeutils.F_READ, codeutils.F_TRUNCATE, codeutils.F_DELETE:
+		config.Instruccion = codeutils.OpcodeStrings[instruction.Opcode]
+		if len(instruction.Args) == 0 {
+			slog.Error(config.Instruccion + " requiere el nombre del archivo")
+			break
+		}
+		config.Exec_values.Str = instruction.Args[0]
+
 	case codeutils.INIT_PROC:
 		config.Instruccion = "INIT_PROC"
-		if len(instruction.Args) != 2 {
-			slog.Error("INIT_PROC requiere 2 argumentos")
+		if len(instruction.Args) < 2 || len(instruction.Args) > 3 {
+			slog.Error("INIT_PROC requiere 2 argumentos y una prioridad opcional")
+			break
 		}
 		arg1, err := strconv.Atoi(instruction.Args[1])
 		if err != nil {
@@ -578,6 +764,115 @@ func asign() {
 
 	case codeutils.DUMP_MEMORY:
 		config.Instruccion = "DUMP_MEMORY"
+
+	case codeutils.THREAD_CREATE:
+		config.Instruccion = "THREAD_CREATE"
+		if len(instruction.Args) < 1 || len(instruction.Args) > 2 {
+			slog.Error("THREAD_CREATE requiere 1 argumento y una prioridad opcional")
+			break
+		}
+		prioridad := 0
+		if len(instruction.Args) > 1 {
+			var err error
+			prioridad, err = strconv.Atoi(instruction.Args[1])
+			if err != nil {
+				slog.Error("error convirtiendo Prioridad en THREAD_CREATE ", "error", err)
+			}
+		}
+		config.Exec_values.Str = instruction.Args[0]
+		config.Exec_values.Arg1 = prioridad
+
+	case codeutils.THREAD_JOIN:
+		config.Instruccion = "THREAD_JOIN"
+		if len(instruction.Args) != 1 {
+			slog.Error("THREAD_JOIN requiere 1 argumento")
+		}
+		tid, err := strconv.Atoi(instruction.Args[0])
+		if err != nil {
+			slog.Error("error convirtiendo TID en THREAD_JOIN ", "error", err)
+		}
+		config.Exec_values.Arg1 = tid
+
+	case codeutils.THREAD_EXIT:
+		config.Instruccion = "THREAD_EXIT"
+
+	case codeutils.MSG_SEND, codeutils.MSG_RECV:
+		config.Instruccion = codeutils.OpcodeStrings[instruction.Opcode]
+		if len(instruction.Args) != 3 {
+			slog.Error(config.Instruccion + " requiere 3 argumentos")
+			break
+		}
+		config.Exec_values.Str = instruction.Args[0]
+		direccion, err := strconv.Atoi(instruction.Args[1])
+		if err != nil {
+			slog.Error("error convirtiendo Direccion en "+config.Instruccion, "error", err)
+		}
+		tamanio, err := strconv.Atoi(instruction.Args[2])
+		if err != nil {
+			slog.Error("error convirtiendo Tamaño en "+config.Instruccion, "error", err)
+		}
+		config.Exec_values.Arg1 = direccion
+		config.Exec_values.Arg2 = tamanio
+
+	case codeutils.SHM_ATTACH:
+		config.Instruccion = "SHM_ATTACH"
+		if len(instruction.Args) < 2 || len(instruction.Args) > 3 {
+			slog.Error("SHM_ATTACH requiere 2 argumentos y un destino opcional")
+			break
+		}
+		tamanio, err := strconv.Atoi(instruction.Args[1])
+		if err != nil {
+			slog.Error("error convirtiendo Tamaño en SHM_ATTACH ", "error", err)
+		}
+		config.Exec_values.Str = instruction.Args[0]
+		config.Exec_values.Arg1 = tamanio
+
+	case codeutils.SHM_DETACH:
+		config.Instruccion = "SHM_DETACH"
+		if len(instruction.Args) != 1 {
+			slog.Error("SHM_DETACH requiere 1 argumento")
+		}
+		config.Exec_values.Str = instruction.Args[0]
+
+	case codeutils.MALLOC:
+		config.Instruccion = "MALLOC"
+		if len(instruction.Args) < 1 || len(instruction.Args) > 2 {
+			slog.Error("MALLOC requiere el tamaño y un destino opcional")
+			break
+		}
+		tamanio, err := strconv.Atoi(instruction.Args[0])
+		if err != nil {
+			slog.Error("error convirtiendo Tamaño en MALLOC ", "error", err)
+		}
+		config.Exec_values.Arg1 = tamanio
+
+	case codeutils.SLEEP:
+		config.Instruccion = "SLEEP"
+		if len(instruction.Args) != 1 {
+			slog.Error("SLEEP requiere 1 argumento")
+		}
+		tiempo, err := strconv.Atoi(instruction.Args[0])
+		if err != nil {
+			slog.Error("error convirtiendo Tiempo en SLEEP ", "error", err)
+		}
+		config.Exec_values.Arg1 = tiempo
+
+	case codeutils.WAIT_CHILD:
+		config.Instruccion = "WAIT_CHILD"
+		if len(instruction.Args) > 1 {
+			slog.Error("WAIT_CHILD acepta como máximo 1 argumento")
+		}
+		config.Exec_values.Str = ""
+		if len(instruction.Args) == 1 {
+			config.Exec_values.Str = instruction.Args[0]
+		}
+
+	case codeutils.WAIT, codeutils.SIGNAL:
+		config.Instruccion = codeutils.OpcodeStrings[instruction.Opcode]
+		if len(instruction.Args) != 1 {
+			slog.Error(config.Instruccion + " requiere 1 argumento")
+		}
+		config.Exec_values.Str = instruction.Args[0]
 	}
 }
 
@@ -588,6 +883,7 @@ func sendResults(pid int, pc int, motivo string) {
 		Endpoint: "cpu-results",
 		Queries: map[string]string{
 			"pid": fmt.Sprint(pid),
+			"tid": fmt.Sprint(config.Pcb.TID),
 			"pc": fmt.Sprint(pc),
 			"reason": motivo,
 		},
@@ -595,6 +891,7 @@ func sendResults(pid int, pc int, motivo string) {
 
 	payload := config.DispatchResponse{
 		PID:    pid,
+		TID:    config.Pcb.TID,
 		PC:     pc,
 		Motivo: motivo,
 	}
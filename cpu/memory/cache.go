@@ -4,18 +4,30 @@ import (
 	"fmt"
 	"log/slog"
 	"ssoo-cpu/config"
+	"ssoo-utils/clock"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"time"
 )
 
+var (
+	cacheHits   = metrics.NewCounter("ssoo_cpu_cache_hits_total", "Búsquedas de páginas resueltas por la caché.")
+	cacheMisses = metrics.NewCounter("ssoo_cpu_cache_misses_total", "Búsquedas de páginas que no estaban en la caché.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ssoo_cpu_cache_hit_ratio", "Proporción de aciertos de la caché de páginas.", func() float64 {
+		return metrics.Ratio(cacheHits, cacheMisses)
+	})
+}
+
 func SearchPageInCache(logicAddr []int) ([]byte, bool) {
 
-	time.Sleep(time.Duration(config.Values.CacheDelay)*time.Millisecond)
+	clock.Sleep(time.Duration(config.Values.CacheDelay)*time.Millisecond)
 
 	for _, entrada := range config.Cache.Entries {
 
 		if areSlicesEqual(entrada.Page, logicAddr) {
-
 			logger.RequiredLog(false, uint(config.Pcb.PID), "Cache Hit", map[string]string{
 				"Pagina": fmt.Sprint(logicAddr),
 			})
@@ -35,7 +47,7 @@ func SearchPageInCache(logicAddr []int) ([]byte, bool) {
 
 func AddEntryCache(logicAddr []int, content []byte) {
 
-	time.Sleep(time.Duration(config.Values.CacheDelay)*time.Millisecond)
+	clock.Sleep(time.Duration(config.Values.CacheDelay)*time.Millisecond)
 
 	if config.Cache.ReplacementAlg == "CLOCK" {
 		AddEntryCacheClock(logicAddr, content)
@@ -252,14 +264,17 @@ func UseCache(logicAddr []int) {
 	}
 }
 
+// IsInCache es donde se decide si una página se busca en memoria, así que es el único lugar que cuenta
+// hits y misses: SearchPageInCache se llama también después de cargar la página y siempre la encuentra.
 func IsInCache(logicAddr []int) bool {
 	for _, entrada := range config.Cache.Entries {
 		if areSlicesEqual(entrada.Page, logicAddr) {
-
+			cacheHits.Inc()
 			return true
 		}
 	}
 
+	cacheMisses.Inc()
 	logger.RequiredLog(false, uint(config.Pcb.PID), "Cache Miss", map[string]string{
 		"Pagina": fmt.Sprint(logicAddr),
 	})
@@ -10,6 +10,7 @@ import (
 	"ssoo-cpu/config"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
+	"ssoo-utils/memoryutils"
 	"ssoo-utils/parsers"
 	"strconv"
 	"strings"
@@ -25,7 +26,8 @@ func fromLogicAddrToString(logicAddr []int) string {
 	return strings.Join(strs, "|")
 }
 
-func findFrameInMemory(logicAddr []int,pid int) (int, bool) {
+// findFrameInMemory le pide el marco a memoria. shared indica que otra CPU puede usar el mismo marco.
+func findFrameInMemory(logicAddr []int,pid int) (frame int, shared bool, found bool) {
 
 	str := fromLogicAddrToString(logicAddr)
 
@@ -43,31 +45,31 @@ func findFrameInMemory(logicAddr []int,pid int) (int, bool) {
 	if err != nil {
 		slog.Error("error al realizar la solicitud a la memoria ", "error", err)
 		MandarDumpMemory(config.Pcb.PID)
-		return 0, false
+		return 0, false, false
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		slog.Error("respuesta no exitosa", "respuesta", resp.Status)
 		MandarDumpMemory(config.Pcb.PID)
-		return 0, false
+		return 0, false, false
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		slog.Error("error al leer el cuerpo de la respuesta", "error", err)
 		MandarDumpMemory(config.Pcb.PID)
-		return 0, false
+		return 0, false, false
 	}
 
-	frame, err := strconv.Atoi(string(bodyBytes))
+	frame, err = strconv.Atoi(string(bodyBytes))
 	if err != nil {
 		slog.Error("error al convertir la respuesta a int", "respuesta", string(bodyBytes), "error", err)
 		MandarDumpMemory(config.Pcb.PID)
-		return 0, false
+		return 0, false, false
 	}
 
-	return frame, true
+	return frame, resp.Header.Get(memoryutils.SharedHeader) == "true", true
 }
 
 func FindMemoryConfig() bool {
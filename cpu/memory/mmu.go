@@ -19,14 +19,22 @@ func StringToLogicAddress(str string) []int {
 }
 
 func Traducir(addr []int,pid int) ([]int,bool) {
+	fisicAddr, _, found := translate(addr,pid)
+	return fisicAddr, found
+}
+
+// translate traduce como Traducir e indica si la página es compartida con otra CPU (segmento compartido o
+// proceso con hilos). Las compartidas no entran a la TLB y no deben pasar por la caché.
+func translate(addr []int,pid int) ([]int,bool,bool) {
 
 	if len(addr) == 0 {
-		return nil,false
+		return nil,false,false
 	}
 
 	delta := addr[len(addr)-1]
 	page := addr[:len(addr)-1]
 	found := false
+	shared := false
 	frame := -1
 
 	if config.Tlb.Capacity != 0{
@@ -34,41 +42,43 @@ func Traducir(addr []int,pid int) ([]int,bool) {
 	}
 
 	if !found {
-		frame, found = findFrameInMemory(page,pid) //memoria
+		frame, shared, found = findFrameInMemory(page,pid) //memoria
 		if !found {
-			frame, found = findFrameInMemory(page,pid)
+			frame, shared, found = findFrameInMemory(page,pid)
 			if !found{
-				return nil, false
+				return nil, false, false
 			}
 		}
 
-		AddEntryTLB(page, frame,pid)
+		if !shared {
+			AddEntryTLB(page, frame,pid)
+		}
 	}
 
 	fisicAddr := make([]int, 2)
 	fisicAddr[0] = frame
 	fisicAddr[1] = delta
 
-	return fisicAddr,true
+	return fisicAddr,shared,true
 }
 
 func WriteMemory(logicAddr []int, value []byte) bool{
 
 	base := logicAddr[:len(logicAddr)-1]
 
-	if config.CacheEnable{
+	fisicAddr,shared,flag := translate(logicAddr,config.Pcb.PID) //traduzco la direccion
+
+	if !flag {
+		slog.Error("Error"," al traducir la dirección logica, ",fmt.Sprint(logicAddr))
+		return false
+	}
+
+	if config.CacheEnable && !shared{
 		if IsInCache(base){ //si la pagina esta en cache
 			WriteCache(logicAddr,value)
 
 		} else{ //si la pagina no esta en cache
 
-			fisicAddr,flag := Traducir(logicAddr,config.Pcb.PID) //traduzco la direccion
-			
-			if !flag {
-				slog.Error("Error"," al traducir la dirección logica, ",fmt.Sprint(logicAddr))
-				return false
-			}
-
 			page, flag := GetPageInMemory(fisicAddr,base) //busco la pagina
 			
 			if !flag{
@@ -81,13 +91,6 @@ func WriteMemory(logicAddr []int, value []byte) bool{
 		}
 	} else {
 
-		fisicAddr,flag := Traducir(logicAddr,config.Pcb.PID) //traduzco la direccion
-		
-		if !flag {
-			slog.Error("Error"," al traducir la dirección logica, ",fmt.Sprint(logicAddr))
-			return false
-		}
-
 		escrito := 0
 		pageSize := config.MemoryConf.PageSize
 		bytesRestantes := len(value)
@@ -226,12 +229,12 @@ func sum(val []int, mod int) {
 func ReadMemory(logicAddr []int, size int) int{
 
 	base := logicAddr[:len(logicAddr)-1]
-	fisicAddr, flag := Traducir(logicAddr,config.Pcb.PID)
+	fisicAddr, shared, flag := translate(logicAddr,config.Pcb.PID)
 	frame := fisicAddr
 
 	if !flag {
 
-		fisicAddr, flag = Traducir(logicAddr,config.Pcb.PID)
+		fisicAddr, shared, flag = translate(logicAddr,config.Pcb.PID)
 
 		if !flag{
 			slog.Error("Error al traducir la pagina ","Pagina", base)
@@ -240,7 +243,7 @@ func ReadMemory(logicAddr []int, size int) int{
 		}
 	}
 
-	if config.CacheEnable{
+	if config.CacheEnable && !shared{
 
 		if !IsInCache(base){
 			page, _ := GetPageInMemory(fisicAddr,base)
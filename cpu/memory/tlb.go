@@ -4,9 +4,21 @@ import (
 	"ssoo-cpu/config"
 	"time"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"fmt"
 )
 
+var (
+	tlbHits   = metrics.NewCounter("ssoo_cpu_tlb_hits_total", "Traducciones resueltas por la TLB.")
+	tlbMisses = metrics.NewCounter("ssoo_cpu_tlb_misses_total", "Traducciones que no estaban en la TLB.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ssoo_cpu_tlb_hit_ratio", "Proporción de aciertos de la TLB.", func() float64 {
+		return metrics.Ratio(tlbHits, tlbMisses)
+	})
+}
+
 
 func areSlicesEqual(a, b []int) bool {
 	if len(a) != len(b) {
@@ -25,6 +37,7 @@ func findFrame(page []int,pid int) (int, bool) {
 	for i, entry := range config.Tlb.Entries {
 		if areSlicesEqual(entry.Page, page) && entry.Pid == pid{
 			//tlb hit
+			tlbHits.Inc()
 			if config.Tlb.ReplacementAlg == "LRU" {
 				config.Tlb.Entries[i].LastUsed = time.Now().UnixNano()
 			}
@@ -48,6 +61,7 @@ func findFrame(page []int,pid int) (int, bool) {
 	}
 
 	//TLB MISS
+	tlbMisses.Inc()
 	logger.RequiredLog(false,uint(config.Pcb.PID),"TLB MISS",map[string]string{
 		"Pagina": fmt.Sprint(page),
 	})
@@ -103,6 +117,17 @@ func ClearTLB() {
 	config.Tlb.Entries = make([]config.Tlb_entries, 0, config.Tlb.Capacity)
 }
 
+// FlushTLB saca las entradas del proceso, para cuando memoria le cambia la tabla de páginas.
+func FlushTLB(pid int) {
+	entradas := make([]config.Tlb_entries, 0, config.Tlb.Capacity)
+	for _, entry := range config.Tlb.Entries {
+		if entry.Pid != pid {
+			entradas = append(entradas, entry)
+		}
+	}
+	config.Tlb.Entries = entradas
+}
+
 func printTLB() {
 	fmt.Println("----- Estado actual de la TLB -----")
 	for i, entry := range config.Tlb.Entries {
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"log/slog"
+	"ssoo-utils/configManager"
+	"ssoo-utils/httputils"
+)
+
+type FSConfig struct {
+	IpKernel         string     `json:"ip_kernel"`
+	PortKernel       int        `json:"port_kernel"`
+	IpMemory         string     `json:"ip_memory"`
+	PortMemory       int        `json:"port_memory"`
+	PortFilesystem   int        `json:"port_filesystem"`
+	DeviceName       string     `json:"device_name"`
+	LogLevel         slog.Level `json:"log_level"`
+	ClockMode        string     `json:"clock_mode"`
+	MountDir         string     `json:"mount_dir"`
+	BlockSize        int        `json:"block_size"`
+	BlockCount       int        `json:"block_count"`
+	BlockAccessDelay int        `json:"block_access_delay"`
+}
+
+var Values FSConfig
+var configFilePath string = "/config/filesystem_config.json"
+
+func SetFilePath(path string) {
+	configFilePath = path
+}
+
+func Load() {
+	configFilePath = configManager.GetDefaultExePath() + configFilePath
+
+	err := configManager.LoadConfig(configFilePath, &Values)
+	if err != nil {
+		panic(err)
+	}
+
+	if Values.IpKernel == "self" {
+		Values.IpKernel = httputils.GetOutboundIP()
+	}
+	if Values.IpMemory == "self" {
+		Values.IpMemory = httputils.GetOutboundIP()
+	}
+	Values.MountDir = configManager.GetDefaultExePath() + Values.MountDir
+}
@@ -0,0 +1,334 @@
+package disk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"ssoo-utils/clock"
+	"sync"
+	"time"
+)
+
+/*
+Dispositivo de bloques del filesystem.
+
+En el punto de montaje hay:
+  - bloques.dat: la imagen del disco, block_count bloques de block_size bytes.
+  - bitmap.dat: un bit por bloque, en 1 si el bloque es de algún archivo.
+  - files/: la metadata de cada archivo en JSON, con su tamaño y sus bloques en orden.
+
+Los bloques se asignan y se liberan al cambiar el tamaño de un archivo, un archivo vacío no tiene bloques.
+Cada acceso a un bloque de datos demora block_access_delay.
+*/
+
+var (
+	ErrNotFound    = errors.New("el archivo no existe")
+	ErrExists      = errors.New("el archivo ya existe")
+	ErrNoSpace     = errors.New("no hay bloques libres suficientes")
+	ErrOutOfRange  = errors.New("acceso fuera del archivo")
+	ErrInvalidName = errors.New("nombre de archivo inválido")
+)
+
+type Metadata struct {
+	Size   int   `json:"size"`
+	Blocks []int `json:"blocks"`
+}
+
+var (
+	mu          sync.Mutex
+	mountDir    string
+	blockSize   int
+	blockCount  int
+	accessDelay time.Duration
+	image       *os.File
+	bitmap      []byte
+)
+
+// #region MOUNT
+
+// Mount abre el disco en dir, creando la imagen y el bitmap si no existen. Los archivos de un montaje anterior se conservan.
+func Mount(dir string, size int, count int, delay time.Duration) error {
+	if size <= 0 || count <= 0 {
+		return fmt.Errorf("tamaño de bloque (%d) o cantidad de bloques (%d) inválidos", size, count)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	mountDir = dir
+	blockSize = size
+	blockCount = count
+	accessDelay = delay
+
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	image, err = os.OpenFile(filepath.Join(dir, "bloques.dat"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if err := image.Truncate(int64(size * count)); err != nil {
+		return err
+	}
+
+	bitmap, err = os.ReadFile(filepath.Join(dir, "bitmap.dat"))
+	if errors.Is(err, os.ErrNotExist) || len(bitmap) != (count+7)/8 {
+		bitmap = make([]byte, (count+7)/8)
+		err = saveBitmap()
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Filesystem montado", "dir", dir, "block_size", size, "block_count", count, "libres", freeBlocks())
+	return nil
+}
+
+func Unmount() {
+	mu.Lock()
+	defer mu.Unlock()
+	if image != nil {
+		image.Close()
+		image = nil
+	}
+}
+
+// #endregion
+
+// #region FILES
+
+func Create(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := load(name); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return save(name, &Metadata{Blocks: []int{}})
+}
+
+// Stat devuelve la metadata del archivo, o ErrNotFound.
+func Stat(name string) (Metadata, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	meta, err := load(name)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return *meta, nil
+}
+
+func Truncate(name string, size int) error {
+	if size < 0 {
+		return ErrOutOfRange
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	meta, err := load(name)
+	if err != nil {
+		return err
+	}
+	if err := resize(meta, size); err != nil {
+		return err
+	}
+	return save(name, meta)
+}
+
+// Write escribe data en el archivo a partir de offset, agrandándolo si hace falta.
+func Write(name string, offset int, data []byte) error {
+	if offset < 0 {
+		return ErrOutOfRange
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	meta, err := load(name)
+	if err != nil {
+		return err
+	}
+	if end := offset + len(data); end > meta.Size {
+		if err := resize(meta, end); err != nil {
+			return err
+		}
+		if err := save(name, meta); err != nil {
+			return err
+		}
+	}
+
+	return access(meta, offset, len(data), func(at int64, from int, to int) error {
+		_, err := image.WriteAt(data[from:to], at)
+		return err
+	})
+}
+
+// Read lee size bytes del archivo a partir de offset. No se puede leer más allá del final del archivo.
+func Read(name string, offset int, size int) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	meta, err := load(name)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || size < 0 || offset+size > meta.Size {
+		return nil, ErrOutOfRange
+	}
+
+	data := make([]byte, size)
+	err = access(meta, offset, size, func(at int64, from int, to int) error {
+		_, err := image.ReadAt(data[from:to], at)
+		return err
+	})
+	return data, err
+}
+
+func Delete(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	meta, err := load(name)
+	if err != nil {
+		return err
+	}
+	if err := resize(meta, 0); err != nil {
+		return err
+	}
+	return os.Remove(metadataPath(name))
+}
+
+// #endregion
+
+// #region BLOCKS
+
+// resize asigna o libera bloques para que el archivo tenga size bytes. Los bloques nuevos quedan en cero,
+// y al achicarse también lo que queda después de size en el último bloque, para que crecer de nuevo no
+// muestre datos viejos. Si no hay bloques suficientes el archivo no cambia. Requiere el lock tomado.
+func resize(meta *Metadata, size int) error {
+	needed := (size + blockSize - 1) / blockSize
+
+	if needed > len(meta.Blocks) {
+		added := make([]int, 0, needed-len(meta.Blocks))
+		for block := 0; block < blockCount && len(added) < cap(added); block++ {
+			if !isUsed(block) {
+				added = append(added, block)
+			}
+		}
+		if len(added) < cap(added) {
+			return ErrNoSpace
+		}
+
+		zeros := make([]byte, blockSize)
+		for _, block := range added {
+			if _, err := image.WriteAt(zeros, int64(block*blockSize)); err != nil {
+				return err
+			}
+			setUsed(block, true)
+		}
+		meta.Blocks = append(meta.Blocks, added...)
+	}
+
+	if inner := size % blockSize; size < meta.Size && inner != 0 {
+		tail := make([]byte, blockSize-inner)
+		if _, err := image.WriteAt(tail, int64(meta.Blocks[needed-1]*blockSize+inner)); err != nil {
+			return err
+		}
+	}
+
+	for _, block := range meta.Blocks[needed:] {
+		setUsed(block, false)
+	}
+	meta.Blocks = meta.Blocks[:needed]
+	meta.Size = size
+
+	slog.Debug("Archivo redimensionado", "size", size, "bloques", len(meta.Blocks), "libres", freeBlocks())
+	return saveBitmap()
+}
+
+// access recorre los bloques que cubren size bytes desde offset y llama a do con la posición en la imagen
+// y el rango [from, to) del buffer que le corresponde a ese bloque.
+func access(meta *Metadata, offset int, size int, do func(at int64, from int, to int) error) error {
+	for done := 0; done < size; {
+		index := (offset + done) / blockSize
+		inner := (offset + done) % blockSize
+		chunk := min(blockSize-inner, size-done)
+
+		clock.Sleep(accessDelay)
+		slog.Debug("Acceso a bloque", "bloque", meta.Blocks[index], "desplazamiento", inner, "bytes", chunk)
+		if err := do(int64(meta.Blocks[index]*blockSize+inner), done, done+chunk); err != nil {
+			return err
+		}
+		done += chunk
+	}
+	return nil
+}
+
+func isUsed(block int) bool { return bitmap[block/8]&(1<<(block%8)) != 0 }
+
+func setUsed(block int, used bool) {
+	if used {
+		bitmap[block/8] |= 1 << (block % 8)
+	} else {
+		bitmap[block/8] &^= 1 << (block % 8)
+	}
+}
+
+func freeBlocks() int {
+	free := 0
+	for block := range blockCount {
+		if !isUsed(block) {
+			free++
+		}
+	}
+	return free
+}
+
+func saveBitmap() error {
+	return os.WriteFile(filepath.Join(mountDir, "bitmap.dat"), bitmap, 0666)
+}
+
+// #endregion
+
+// #region METADATA
+
+func metadataPath(name string) string {
+	return filepath.Join(mountDir, "files", name+".json")
+}
+
+func load(name string) (*Metadata, error) {
+	if name == "" || filepath.Base(name) != name || name == "." || name == ".." {
+		return nil, ErrInvalidName
+	}
+	data, err := os.ReadFile(metadataPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := new(Metadata)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("metadata de %s corrupta: %w", name, err)
+	}
+	return meta, nil
+}
+
+func save(name string, meta *Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadataPath(name), data, 0666)
+}
+
+// #endregion
@@ -0,0 +1,215 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// mount monta un disco de count bloques de size bytes en un directorio temporal.
+func mount(t *testing.T, size int, count int) string {
+	dir := t.TempDir()
+	if err := Mount(dir, size, count, 0); err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+	t.Cleanup(Unmount)
+	return dir
+}
+
+func TestErrors(t *testing.T) {
+	mount(t, 4, 4)
+	if err := Create("a"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := Write("a", 0, []byte("abcd")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"crear uno que existe", func() error { return Create("a") }, ErrExists},
+		{"nombre con ruta", func() error { return Create("../a") }, ErrInvalidName},
+		{"nombre vacío", func() error { return Create("") }, ErrInvalidName},
+		{"leer uno que no existe", func() error { _, err := Read("b", 0, 1); return err }, ErrNotFound},
+		{"leer después del final", func() error { _, err := Read("a", 2, 3); return err }, ErrOutOfRange},
+		{"leer con offset negativo", func() error { _, err := Read("a", -1, 1); return err }, ErrOutOfRange},
+		{"escribir con offset negativo", func() error { return Write("a", -1, []byte("x")) }, ErrOutOfRange},
+		{"truncar a tamaño negativo", func() error { return Truncate("a", -1) }, ErrOutOfRange},
+		{"truncar uno que no existe", func() error { return Truncate("b", 4) }, ErrNotFound},
+		{"borrar uno que no existe", func() error { return Delete("b") }, ErrNotFound},
+		{"escribir más allá del disco", func() error { return Write("a", 0, make([]byte, 17)) }, ErrNoSpace},
+		{"truncar más allá del disco", func() error { return Truncate("a", 17) }, ErrNoSpace},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.op(); !errors.Is(err, c.want) {
+				t.Errorf("error %v, se esperaba %v", err, c.want)
+			}
+		})
+	}
+}
+
+type write struct {
+	offset int
+	data   string
+}
+
+func TestWriteRead(t *testing.T) {
+	cases := []struct {
+		name   string
+		writes []write
+		want   string
+		blocks int
+	}{
+		{"vacío", nil, "", 0},
+		{"un bloque justo", []write{{0, "abcd"}}, "abcd", 1},
+		{"cruza bloques", []write{{0, "abcdefghij"}}, "abcdefghij", 3},
+		{"con hueco", []write{{6, "xy"}}, "\x00\x00\x00\x00\x00\x00xy", 2},
+		{"sobreescribe en el medio", []write{{0, "abcdefgh"}, {3, "XYZ"}}, "abcXYZgh", 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mount(t, 4, 4)
+			if err := Create("f"); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			for _, w := range c.writes {
+				if err := Write("f", w.offset, []byte(w.data)); err != nil {
+					t.Fatalf("Write(%d, %q): %v", w.offset, w.data, err)
+				}
+			}
+
+			meta, err := Stat("f")
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if meta.Size != len(c.want) || len(meta.Blocks) != c.blocks {
+				t.Errorf("tamaño %d con %d bloques, se esperaba %d con %d", meta.Size, len(meta.Blocks), len(c.want), c.blocks)
+			}
+			if free := freeBlocks(); free != 4-c.blocks {
+				t.Errorf("%d bloques libres, se esperaban %d", free, 4-c.blocks)
+			}
+
+			data, err := Read("f", 0, len(c.want))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if string(data) != c.want {
+				t.Errorf("se leyó %q, se esperaba %q", data, c.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		name   string
+		sizes  []int // truncados sucesivos sobre "abcdefghij"
+		want   string
+		blocks int
+	}{
+		{"agranda con ceros", []int{14}, "abcdefghij\x00\x00\x00\x00", 4},
+		{"achica liberando bloques", []int{4}, "abcd", 1},
+		{"achica a cero", []int{0}, "", 0},
+		{"achica y agranda en el mismo bloque", []int{2, 4}, "ab\x00\x00", 1},
+		{"achica y agranda a otro bloque", []int{5, 10}, "abcde\x00\x00\x00\x00\x00", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mount(t, 4, 4)
+			if err := Create("f"); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := Write("f", 0, []byte("abcdefghij")); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			for _, size := range c.sizes {
+				if err := Truncate("f", size); err != nil {
+					t.Fatalf("Truncate(%d): %v", size, err)
+				}
+			}
+
+			meta, _ := Stat("f")
+			if len(meta.Blocks) != c.blocks {
+				t.Errorf("%d bloques, se esperaban %d", len(meta.Blocks), c.blocks)
+			}
+			if free := freeBlocks(); free != 4-c.blocks {
+				t.Errorf("%d bloques libres, se esperaban %d", free, 4-c.blocks)
+			}
+			data, err := Read("f", 0, len(c.want))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if string(data) != c.want {
+				t.Errorf("se leyó %q, se esperaba %q", data, c.want)
+			}
+		})
+	}
+}
+
+func TestNoSpaceLeavesFileUnchanged(t *testing.T) {
+	mount(t, 4, 4)
+	for _, name := range []string{"a", "b"} {
+		if err := Create(name); err != nil {
+			t.Fatalf("Create(%s): %v", name, err)
+		}
+	}
+	if err := Write("a", 0, []byte("0123456789ab")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := Write("b", 0, []byte("xyzw")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if err := Write("b", 4, []byte("!")); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("error %v, se esperaba %v", err, ErrNoSpace)
+	}
+	meta, _ := Stat("b")
+	if meta.Size != 4 || len(meta.Blocks) != 1 {
+		t.Errorf("b quedó con tamaño %d y %d bloques, se esperaba 4 y 1", meta.Size, len(meta.Blocks))
+	}
+	if free := freeBlocks(); free != 0 {
+		t.Errorf("%d bloques libres, se esperaban 0", free)
+	}
+}
+
+func TestDeleteFreesBlocks(t *testing.T) {
+	dir := mount(t, 4, 4)
+	for _, name := range []string{"a", "b"} {
+		if err := Create(name); err != nil {
+			t.Fatalf("Create(%s): %v", name, err)
+		}
+	}
+	if err := Write("a", 0, []byte("abcdefgh")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := Write("b", 0, []byte("ijkl")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if err := Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := Stat("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat después de Delete: %v, se esperaba %v", err, ErrNotFound)
+	}
+	if free := freeBlocks(); free != 3 {
+		t.Errorf("%d bloques libres, se esperaban 3", free)
+	}
+
+	// El bitmap y los archivos que quedan se conservan al volver a montar.
+	Unmount()
+	if err := Mount(dir, 4, 4, 0); err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+	if free := freeBlocks(); free != 3 {
+		t.Errorf("%d bloques libres al volver a montar, se esperaban 3", free)
+	}
+	data, err := Read("b", 0, 4)
+	if err != nil || !bytes.Equal(data, []byte("ijkl")) {
+		t.Errorf("Read(b) = %q, %v, se esperaba \"ijkl\"", data, err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+// #region SECTION: IMPORTS
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"ssoo-filesystem/config"
+	"ssoo-filesystem/disk"
+	"ssoo-utils/clock"
+	"ssoo-utils/httputils"
+	"ssoo-utils/logger"
+	"ssoo-utils/memoryutils"
+	"ssoo-utils/metrics"
+	"ssoo-utils/parsers"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// #endregion
+
+/*
+Módulo filesystem.
+
+Se conecta al kernel como un dispositivo de IO con el nombre device_name y atiende las syscalls F_*.
+Cada pedido llega como "pid|tiempo|pid de memoria|OPERACIÓN args...": el primer PID es el del kernel,
+con el que se avisa el fin del pedido, y el segundo el del proceso en memoria, para leer o escribir sus datos.
+*/
+
+var port string
+
+var shutdownSignal = make(chan any)
+
+var fsRequests = metrics.NewCounterVec("ssoo_filesystem_requests_total", "Operaciones de filesystem atendidas.", "op")
+
+func main() {
+
+	// #region SETUP
+
+	config.Load()
+	fmt.Printf("Config Loaded:\n%s", parsers.Struct(config.Values))
+	err := logger.SetupDefault("filesystem", config.Values.LogLevel)
+	defer logger.Close()
+	if err != nil {
+		fmt.Printf("Error setting up logger: %v\n", err)
+		return
+	}
+	slog.Info("Arranca Filesystem")
+
+	err = clock.Setup(config.Values.ClockMode, fmt.Sprintf("%s:%d", config.Values.IpKernel, config.Values.PortKernel))
+	if err != nil {
+		fmt.Printf("Error configurando el reloj: %v\n", err)
+		return
+	}
+
+	err = disk.Mount(config.Values.MountDir, config.Values.BlockSize, config.Values.BlockCount,
+		time.Duration(config.Values.BlockAccessDelay)*time.Millisecond)
+	if err != nil {
+		fmt.Printf("Error montando el filesystem: %v\n", err)
+		return
+	}
+	defer disk.Unmount()
+	port = fmt.Sprint(config.Values.PortFilesystem)
+
+	// #endregion
+
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		go func() {
+			fmt.Println("Se solició cierre. o7")
+			shutdownSignal <- struct{}{}
+			<-shutdownSignal
+			disk.Unmount()
+			os.Exit(0)
+		}()
+	})
+
+	httputils.StartHTTPServer(httputils.GetOutboundIP(), config.Values.PortFilesystem, mux, shutdownSignal)
+
+	kernelPing := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpKernel,
+		Port:     config.Values.PortKernel,
+		Endpoint: "/ping",
+	})
+	_, err = http.Get(kernelPing)
+	if err != nil {
+		fmt.Println("Esperando a Kernel")
+	}
+	for err != nil {
+		time.Sleep(1 * time.Second)
+		_, err = http.Get(kernelPing)
+	}
+
+	var assignedPID uint = 0
+	name := config.Values.DeviceName
+
+	force_kill_chan := make(chan os.Signal, 1)
+	signal.Notify(force_kill_chan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-force_kill_chan
+		fmt.Println()
+		notifyIODisconnected(name, &assignedPID)
+		shutdownSignal <- struct{}{}
+		<-shutdownSignal
+		disk.Unmount()
+		os.Exit(0)
+	}()
+
+	for {
+		retry, err := notifyKernel(name, &assignedPID)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+		if retry {
+			continue
+		}
+		notifyIODisconnected(name, &assignedPID)
+		break
+	}
+}
+
+// #region SECTION: KERNEL CONNECTION
+
+// notifyKernel espera un pedido del kernel y lo atiende. Devuelve false si el kernel pidió el cierre.
+func notifyKernel(name string, pidptr *uint) (bool, error) {
+	log := slog.With("name", name)
+	log.Info("Notificando a Kernel...")
+
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpKernel,
+		Port:     config.Values.PortKernel,
+		Endpoint: "io-notify",
+		Queries: map[string]string{
+			"ip":   httputils.GetOutboundIP(),
+			"port": port,
+			"name": name,
+			"pid":  fmt.Sprint(*pidptr)},
+	})
+	resp, err := http.Post(url, http.MethodPost, http.NoBody)
+	if err != nil {
+		log.Error("Error making POST request", "error", err)
+		time.Sleep(1 * time.Second)
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	*pidptr = 0
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTeapot {
+			log.Info("Server asked for shutdown.")
+			return false, nil
+		}
+		return false, fmt.Errorf("response error: %d", resp.StatusCode)
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	vars := strings.SplitN(string(data), "|", 4)
+	pid, _ := strconv.Atoi(vars[0])
+	*pidptr = uint(pid)
+
+	if len(vars) < 4 {
+		err = fmt.Errorf("pedido sin operación de filesystem: %s", data)
+	} else {
+		memoryPID, _ := strconv.Atoi(vars[2])
+		err = handleOperation(uint(pid), uint(memoryPID), strings.Fields(vars[3]))
+	}
+	if err != nil {
+		logger.RequiredLog(true, *pidptr, "Error en operación de filesystem", map[string]string{"Error": err.Error()})
+	}
+
+	notifyIOFinished(name, pid, err)
+	clock.Release() // el que el kernel tomó al despachar el pedido
+
+	return true, nil
+}
+
+func notifyIOFinished(name string, pid int, failure error) {
+	queries := map[string]string{
+		"ip":   httputils.GetOutboundIP(),
+		"port": port,
+		"name": name,
+		"pid":  fmt.Sprint(pid),
+	}
+	if failure != nil {
+		queries["error"] = url.QueryEscape(failure.Error())
+	}
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpKernel,
+		Port:     config.Values.PortKernel,
+		Endpoint: "io-finished",
+		Queries:  queries,
+	})
+
+	resp, err := http.Post(url, "text/plain", nil)
+	if err != nil {
+		slog.Error("Error haciendo POST", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Error en la respuesta", "Status", resp.StatusCode)
+	}
+}
+
+func notifyIODisconnected(name string, pidptr *uint) {
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpKernel,
+		Port:     config.Values.PortKernel,
+		Endpoint: "io-disconnected",
+		Queries:  map[string]string{"ip": httputils.GetOutboundIP(), "port": port, "name": name, "pid": fmt.Sprint(*pidptr)},
+	})
+	resp, err := http.Post(url, http.MethodPost, http.NoBody)
+	if err != nil {
+		slog.Info("No se pudo notificar a Kernel de desconección, es posible que se haya desconectado")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Error on response", "Status", resp.StatusCode)
+		return
+	}
+
+	slog.Info("Finalización de Filesystem notificada correctamente")
+}
+
+// #endregion
+
+// #region SECTION: OPERATIONS
+
+// handleOperation ejecuta la syscall F_* args[0] sobre el archivo args[1].
+func handleOperation(pid uint, memoryPID uint, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("operación incompleta: %v", args)
+	}
+	op, file := args[0], args[1]
+	numbers, err := parseNumbers(args[2:])
+	if err != nil {
+		return err
+	}
+	fsRequests.With(op).Inc()
+	logger.RequiredLog(true, pid, "Operación de filesystem", map[string]string{
+		"Operación": op,
+		"Archivo":   file,
+		"Args":      fmt.Sprint(numbers),
+	})
+
+	switch op {
+	case "F_CREATE":
+		return disk.Create(file)
+
+	case "F_OPEN":
+		_, err := disk.Stat(file)
+		return err
+
+	case "F_TRUNCATE":
+		if len(numbers) != 1 {
+			return fmt.Errorf("%s requiere el tamaño", op)
+		}
+		return disk.Truncate(file, numbers[0])
+
+	case "F_DELETE":
+		return disk.Delete(file)
+
+	// F_WRITE y F_READ: <archivo> <dirección lógica> <tamaño> <desplazamiento en el archivo>
+	case "F_WRITE":
+		if len(numbers) != 3 {
+			return fmt.Errorf("%s requiere dirección, tamaño y desplazamiento", op)
+		}
+		data, err := memory().Read(memoryPID, numbers[0], numbers[1])
+		if err != nil {
+			return err
+		}
+		return disk.Write(file, numbers[2], data)
+
+	case "F_READ":
+		if len(numbers) != 3 {
+			return fmt.Errorf("%s requiere dirección, tamaño y desplazamiento", op)
+		}
+		data, err := disk.Read(file, numbers[2], numbers[1])
+		if err != nil {
+			return err
+		}
+		return memory().Write(memoryPID, numbers[0], data)
+	}
+	return fmt.Errorf("operación desconocida: %s", op)
+}
+
+func parseNumbers(args []string) ([]int, error) {
+	numbers := make([]int, len(args))
+	for i, arg := range args {
+		number, err := strconv.Atoi(arg)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("argumento inválido: %s", arg)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// #endregion
+
+// #region SECTION: MEMORY
+
+// memory lee y escribe los datos de F_WRITE y F_READ en la memoria del proceso.
+func memory() memoryutils.Client {
+	return memoryutils.Client{Ip: config.Values.IpMemory, Port: config.Values.PortMemory}
+}
+
+// #endregion
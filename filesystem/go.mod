@@ -0,0 +1,3 @@
+module ssoo-filesystem
+
+go 1.24
@@ -11,6 +11,10 @@ type IOConfig struct {
 	PortKernel int        `json:"port_kernel"`
 	LogLevel   slog.Level `json:"log_level"`
 	PortIO     int        `json:"port_io"`
+	ClockMode  string     `json:"clock_mode"`
+	IpMemory   string     `json:"ip_memory"`
+	PortMemory int        `json:"port_memory"`
+	StdinFile  string     `json:"stdin_file"` // de dónde leen los dispositivos STDIN, vacío es la terminal
 }
 
 var Values IOConfig
@@ -31,4 +35,7 @@ func Load() {
 	if Values.IpKernel == "self" {
 		Values.IpKernel = httputils.GetOutboundIP()
 	}
+	if Values.IpMemory == "self" {
+		Values.IpMemory = httputils.GetOutboundIP()
+	}
 }
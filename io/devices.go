@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"ssoo-io/config"
+	"ssoo-utils/logger"
+	"ssoo-utils/memoryutils"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Tipos de dispositivo.
+
+Cada instancia se elige con "nombre:TIPO" al arrancar, sin tipo es GENERIC.
+Un GENERIC solo espera el tiempo del pedido. STDOUT y STDIN además atienden
+IO_STDOUT e IO_STDIN, que mueven len bytes entre la memoria del proceso y el dispositivo:
+  - STDOUT lee el rango de memoria y lo imprime.
+  - STDIN lee una línea de stdin_file, o de la terminal si no hay archivo, y la escribe en memoria
+    completando con ceros o cortándola en len bytes.
+*/
+
+const (
+	GENERIC = "GENERIC"
+	STDOUT  = "STDOUT"
+	STDIN   = "STDIN"
+)
+
+var (
+	stdinMutex  sync.Mutex
+	stdinReader *bufio.Reader
+)
+
+func parseDevice(arg string) (name string, kind string, err error) {
+	name, kind, _ = strings.Cut(arg, ":")
+	kind = strings.ToUpper(kind)
+	switch kind {
+	case "":
+		kind = GENERIC
+	case GENERIC, STDOUT, STDIN:
+	default:
+		return "", "", fmt.Errorf("tipo de dispositivo desconocido para %s: %s", name, kind)
+	}
+	return name, kind, nil
+}
+
+// transfer atiende la operación args ("IO_STDOUT dir tamaño" o "IO_STDIN dir tamaño") del proceso pid.
+func transfer(kind string, pid uint, memoryPID uint, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("operación de IO inválida: %v", args)
+	}
+	address, errAddress := strconv.Atoi(args[1])
+	size, errSize := strconv.Atoi(args[2])
+	if errAddress != nil || errSize != nil || size < 0 {
+		return fmt.Errorf("dirección o tamaño inválido: %v", args[1:])
+	}
+
+	switch {
+	case args[0] == "IO_STDOUT" && kind == STDOUT:
+		data, err := memory().Read(memoryPID, address, size)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[PID %d] %s\n", pid, bytes.TrimRight(data, "\x00"))
+		logger.RequiredLog(true, pid, "STDOUT", map[string]string{"Salida": string(bytes.TrimRight(data, "\x00"))})
+		return nil
+
+	case args[0] == "IO_STDIN" && kind == STDIN:
+		line, err := readLine(pid)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, size)
+		copy(data, line)
+		logger.RequiredLog(true, pid, "STDIN", map[string]string{"Entrada": string(data[:min(len(line), size)])})
+		return memory().Write(memoryPID, address, data)
+	}
+	return fmt.Errorf("un dispositivo %s no atiende %s", kind, args[0])
+}
+
+// readLine devuelve la siguiente línea de la entrada, sin el salto de línea.
+func readLine(pid uint) (string, error) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+
+	if stdinReader == nil {
+		var input io.Reader = os.Stdin
+		if config.Values.StdinFile != "" {
+			file, err := os.Open(config.Values.StdinFile)
+			if err != nil {
+				return "", err
+			}
+			input = file
+		}
+		stdinReader = bufio.NewReader(input)
+	}
+
+	if config.Values.StdinFile == "" {
+		fmt.Printf("[PID %d] Entrada: ", pid)
+	}
+	line, err := stdinReader.ReadString('\n')
+	if errors.Is(err, io.EOF) && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("no se pudo leer la entrada: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// #region SECTION: MEMORY
+
+func memory() memoryutils.Client {
+	return memoryutils.Client{Ip: config.Values.IpMemory, Port: config.Values.PortMemory}
+}
+
+// #endregion
@@ -7,11 +7,14 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"ssoo-io/config"
+	"ssoo-utils/clock"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"ssoo-utils/parsers"
 	"strconv"
 	"strings"
@@ -31,9 +34,15 @@ var port string
 
 var shutdownSignal = make(chan any)
 
+var (
+	ioRequests = metrics.NewCounterVec("ssoo_io_requests_total", "Pedidos de IO atendidos por dispositivo.", "device")
+	ioBusyTime = metrics.NewCounterVec("ssoo_io_busy_seconds_total", "Tiempo ocupado atendiendo pedidos por dispositivo.", "device")
+	ioBusy     = metrics.NewGaugeVec("ssoo_io_busy", "Pedidos en curso por dispositivo.", "device")
+)
+
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Println("Faltan parámetros. Uso: ./io <identificador> ...[nombre]")
+		fmt.Println("Faltan parámetros. Uso: ./io <identificador> ...[nombre[:STDOUT|:STDIN]]")
 		return
 	}
 	id := os.Args[1]
@@ -55,11 +64,18 @@ func main() {
 		return
 	}
 	slog.Info("Arranca IO")
+
+	err = clock.Setup(config.Values.ClockMode, fmt.Sprintf("%s:%d", config.Values.IpKernel, config.Values.PortKernel))
+	if err != nil {
+		fmt.Printf("Error configurando el reloj: %v\n", err)
+		return
+	}
 	port = fmt.Sprint(config.Values.PortIO + id_int)
 
 	// #endregion
 
 	var mux *http.ServeMux = http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTeapot)
 		go func() {
@@ -125,8 +141,13 @@ func main() {
 
 	var wg sync.WaitGroup
 	for n := range count {
+		name, kind, err := parseDevice(names[n])
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
 		wg.Add(1)
-		go createKernelConnection(names[n], &wg)
+		go createKernelConnection(name, kind, &wg)
 	}
 
 	// #endregion
@@ -134,7 +155,7 @@ func main() {
 	wg.Wait()
 }
 
-func createKernelConnection(name string, wg *sync.WaitGroup) {
+func createKernelConnection(name string, kind string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	var assignedPID uint = 0
@@ -145,7 +166,7 @@ func createKernelConnection(name string, wg *sync.WaitGroup) {
 	}{name: name, pidptr: &assignedPID})
 
 	for {
-		retry, err := notifyKernel(name, &assignedPID)
+		retry, err := notifyKernel(name, kind, &assignedPID)
 		if err != nil {
 			slog.Error(err.Error())
 		}
@@ -158,7 +179,7 @@ func createKernelConnection(name string, wg *sync.WaitGroup) {
 	}
 }
 
-func notifyKernel(name string, pidptr *uint) (bool, error) {
+func notifyKernel(name string, kind string, pidptr *uint) (bool, error) {
 	log := slog.With("name", name)
 	log.Info("Notificando a Kernel...")
 
@@ -193,32 +214,52 @@ func notifyKernel(name string, pidptr *uint) (bool, error) {
 		return false, fmt.Errorf("response error: %w", err)
 	}
 
+	// "pid|tiempo", o "pid|tiempo|pid de memoria|OPERACIÓN args..." si el pedido mueve datos (ver devices.go)
 	data, _ := io.ReadAll(resp.Body)
-	vars := strings.Split(string(data), "|")
+	vars := strings.SplitN(string(data), "|", 4)
 	pid, _ := strconv.Atoi(vars[0])
 	duration, _ := strconv.Atoi(vars[1])
 
 	*pidptr = uint(pid)
 	logger.RequiredLog(true, *pidptr, "Inicio de IO", map[string]string{"Tiempo": fmt.Sprint(duration) + "ms"})
-	time.Sleep(time.Duration(duration) * time.Millisecond)
+	ioBusy.With(name).Add(1)
+	start := clock.Now()
+	var failure error
+	if len(vars) == 4 {
+		memoryPID, _ := strconv.Atoi(vars[2])
+		failure = transfer(kind, *pidptr, uint(memoryPID), strings.Fields(vars[3]))
+	}
+	clock.Sleep(time.Duration(duration) * time.Millisecond)
+	ioBusyTime.With(name).Add(clock.Since(start).Seconds())
+	ioRequests.With(name).Inc()
+	ioBusy.With(name).Add(-1)
+	if failure != nil {
+		logger.RequiredLog(true, *pidptr, "Error en IO", map[string]string{"Error": failure.Error()})
+	}
 	logger.RequiredLog(true, *pidptr, "Fin de IO", map[string]string{})
 
-	notifyIOFinished(name, pid)
+	notifyIOFinished(name, pid, failure)
+	clock.Release() // el que el kernel tomó al despachar el pedido
 
 	return true, nil
 }
 
-func notifyIOFinished(name string, pid int) {
+// Si failure no es nil el kernel finaliza al proceso en vez de pasarlo a READY.
+func notifyIOFinished(name string, pid int, failure error) {
 	slog.Info("Notificando a Kernel que IO ha finalizado...")
+	queries := map[string]string{
+		"ip":   fmt.Sprint(httputils.GetOutboundIP()),
+		"port": port,
+		"name": name,
+		"pid":  fmt.Sprint(pid)}
+	if failure != nil {
+		queries["error"] = url.QueryEscape(failure.Error())
+	}
 	url := httputils.BuildUrl(httputils.URLData{
 		Ip:       config.Values.IpKernel,
 		Port:     config.Values.PortKernel,
 		Endpoint: "io-finished",
-		Queries: map[string]string{
-			"ip":   fmt.Sprint(httputils.GetOutboundIP()),
-			"port": port,
-			"name": name,
-			"pid":  fmt.Sprint(pid)},
+		Queries:  queries,
 	})
 	req, err := http.NewRequest(http.MethodPost, url, nil) // nil == no body
 	if err != nil {
@@ -0,0 +1,539 @@
+package kernel_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/devices"
+	"ssoo-kernel/globals"
+	"ssoo-kernel/queues"
+	"ssoo-kernel/resources"
+	"ssoo-kernel/shared"
+	"ssoo-kernel/timeline"
+	"ssoo-utils/codeutils"
+	"ssoo-utils/httputils"
+	"ssoo-utils/logger"
+	"ssoo-utils/pcb"
+	"strconv"
+)
+
+// API de administración: expone el estado del kernel en JSON y permite operar sobre los procesos.
+
+type ProcessInfo struct {
+	PID             uint           `json:"pid"`
+	TID             uint           `json:"tid"`
+	ProcessPID      uint           `json:"process_pid"` // PID en memoria, el del hilo principal
+	ParentPID       *uint          `json:"parent_pid"`
+	State           string         `json:"state"`
+	PC              int            `json:"pc"`
+	Path            string         `json:"path"`
+	Size            int            `json:"size"`
+	InMemory        bool           `json:"in_memory"`
+	EstimatedBurst  int64          `json:"estimated_burst"`
+	LastRealBurst   int64          `json:"last_burst"`
+	Priority        int            `json:"priority"`
+	CurrentPriority int            `json:"current_priority"`
+	Level           int            `json:"level"`
+	LastCPU         string         `json:"last_cpu"`
+	Migrations      int            `json:"migrations"`
+	Metrics         json.Marshaler `json:"metrics"`
+}
+
+type CPUInfo struct {
+	ID   string `json:"id"`
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+	PID  *uint  `json:"pid"`
+}
+
+type IOInstanceInfo struct {
+	IP   string `json:"ip"`
+	Port string `json:"port"`
+	Busy bool   `json:"busy"`
+}
+
+type IORequestInfo struct {
+	PID     uint   `json:"pid"`
+	State   string `json:"state"`
+	Time    int    `json:"time"`
+	Working bool   `json:"working"`
+	Op      string `json:"op,omitempty"` // operación que mueve datos
+}
+
+type IOInfo struct {
+	Name      string           `json:"name"`
+	Instances []IOInstanceInfo `json:"instances"`
+	Requests  []IORequestInfo  `json:"requests"`
+	Queue     devices.Stats    `json:"queue"` // política, profundidad y espera de la cola del dispositivo
+}
+
+func newProcessInfo(process *globals.Process) ProcessInfo {
+	return ProcessInfo{
+		PID:             process.PCB.GetPID(),
+		TID:             process.TID,
+		ProcessPID:      process.MemoryPID(),
+		ParentPID:       process.ParentPID(),
+		State:           process.PCB.GetState().String(),
+		PC:              process.PCB.GetPC(),
+		Path:            process.Path,
+		Size:            process.Size,
+		InMemory:        process.InMemory,
+		EstimatedBurst:  process.EstimatedBurst,
+		LastRealBurst:   process.LastRealBurst,
+		Priority:        process.Priority,
+		CurrentPriority: int(process.CurrentPriority.Load()),
+		Level:           process.Level,
+		LastCPU:         process.LastCPU,
+		Migrations:      process.Migrations,
+		Metrics:         process.PCB.GetKernelMetrics(),
+	}
+}
+
+// GET /processes
+func ListProcesses() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		processes := queues.All()
+		slices.SortFunc(processes, func(a, b *globals.Process) int {
+			return int(a.PCB.GetPID()) - int(b.PCB.GetPID())
+		})
+
+		infos := make([]ProcessInfo, 0, len(processes))
+		for _, process := range processes {
+			infos = append(infos, newProcessInfo(process))
+		}
+		httputils.WriteJSON(w, http.StatusOK, infos)
+	}
+}
+
+type ProcessNode struct {
+	ProcessInfo
+	Threads  []ProcessInfo  `json:"threads,omitempty"`
+	Children []*ProcessNode `json:"children"`
+}
+
+// GET /processes/tree devuelve los procesos anidados bajo su padre, con sus hilos secundarios.
+func ProcessTree() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		processes := queues.All()
+		slices.SortFunc(processes, func(a, b *globals.Process) int {
+			return int(a.PCB.GetPID()) - int(b.PCB.GetPID())
+		})
+
+		nodes := make(map[*globals.Process]*ProcessNode)
+		for _, process := range processes {
+			if !process.IsThread() {
+				nodes[process] = &ProcessNode{ProcessInfo: newProcessInfo(process), Children: make([]*ProcessNode, 0)}
+			}
+		}
+
+		roots := make([]*ProcessNode, 0)
+		for _, process := range processes {
+			if process.IsThread() {
+				if node, exists := nodes[process.Owner]; exists {
+					node.Threads = append(node.Threads, newProcessInfo(process))
+				}
+				continue
+			}
+
+			globals.TreeMutex.Lock()
+			parent := process.Parent
+			globals.TreeMutex.Unlock()
+
+			// El padre pudo descartarse de EXIT (exit_history)
+			if parentNode, exists := nodes[parent]; parent != nil && exists {
+				parentNode.Children = append(parentNode.Children, nodes[process])
+			} else {
+				roots = append(roots, nodes[process])
+			}
+		}
+		httputils.WriteJSON(w, http.StatusOK, roots)
+	}
+}
+
+// GET /processes/{pid}
+func GetProcess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		pid, err := strconv.ParseUint(r.PathValue("pid"), 10, 0)
+		if err != nil {
+			http.Error(w, "Invalid pid", http.StatusBadRequest)
+			return
+		}
+
+		for _, process := range queues.All() {
+			if process.PCB.GetPID() == uint(pid) {
+				httputils.WriteJSON(w, http.StatusOK, newProcessInfo(process))
+				return
+			}
+		}
+		http.Error(w, "Process not found", http.StatusNotFound)
+	}
+}
+
+// GET /queues devuelve los PIDs de cada cola en orden.
+func ListQueues() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := make(map[string][]uint)
+		for _, queue := range queues.Snapshot() {
+			pids := make([]uint, 0, len(queue.Processes))
+			for _, process := range queue.Processes {
+				pids = append(pids, process.PCB.GetPID())
+			}
+			response[queue.Name] = pids
+		}
+		httputils.WriteJSON(w, http.StatusOK, response)
+	}
+}
+
+// GET /cpus
+func ListCPUs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		globals.AvCPUmu.Lock()
+		infos := make([]CPUInfo, 0, len(globals.AvailableCPUs))
+		for _, cpu := range globals.AvailableCPUs {
+			info := CPUInfo{ID: cpu.ID, IP: cpu.IP, Port: cpu.Port}
+			if cpu.Process != nil {
+				pid := cpu.Process.PCB.GetPID()
+				info.PID = &pid
+			}
+			infos = append(infos, info)
+		}
+		globals.AvCPUmu.Unlock()
+
+		httputils.WriteJSON(w, http.StatusOK, infos)
+	}
+}
+
+// GET /ios agrupa las instancias conectadas, los pedidos pendientes y el estado de la cola por nombre de dispositivo.
+func ListIOs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		infos := make([]*IOInfo, 0)
+		byName := make(map[string]*IOInfo)
+		get := func(name string) *IOInfo {
+			info, ok := byName[name]
+			if !ok {
+				info = &IOInfo{Name: name, Instances: []IOInstanceInfo{}, Requests: []IORequestInfo{}}
+				byName[name] = info
+				infos = append(infos, info)
+			}
+			return info
+		}
+
+		globals.AvIOmu.Lock()
+		for _, io := range globals.AvailableIOs {
+			info := get(io.Name)
+			info.Instances = append(info.Instances, IOInstanceInfo{IP: io.IP, Port: io.Port, Busy: !io.Disp})
+		}
+		globals.AvIOmu.Unlock()
+
+		for _, blocked := range globals.BlockedList() {
+			if blocked.DUMP_MEMORY || blocked.Sleep {
+				continue
+			}
+			info := get(blocked.Name)
+			info.Requests = append(info.Requests, IORequestInfo{
+				PID:     blocked.Process.PCB.GetPID(),
+				State:   blocked.Process.PCB.GetState().String(),
+				Time:    blocked.Time,
+				Working: blocked.Working,
+				Op:      blocked.Op,
+			})
+		}
+
+		stats := devices.Snapshot()
+		for _, name := range slices.Sorted(maps.Keys(stats)) {
+			get(name).Queue = stats[name]
+		}
+
+		httputils.WriteJSON(w, http.StatusOK, infos)
+	}
+}
+
+// GET /deadlocks devuelve los ciclos de espera actuales entre recursos y los deadlocks ya resueltos.
+func Deadlocks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		httputils.WriteJSON(w, http.StatusOK, resources.Status())
+	}
+}
+
+// GET /timeline devuelve la línea de tiempo de la corrida en JSON, /timeline/chart como diagrama de Gantt.
+func Timeline() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t := timeline.Build(queues.All())
+		if r.URL.Path == "/timeline/chart" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			t.WriteHTML(w)
+			return
+		}
+		httputils.WriteJSON(w, http.StatusOK, t)
+	}
+}
+
+// /process: POST crea un proceso, DELETE lo finaliza.
+func HandleProcess() http.HandlerFunc {
+	submit, kill := SubmitProcess(), KillProcess()
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			submit(w, r)
+		case http.MethodDelete:
+			kill(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+/*
+POST /process?size=&priority=&file= crea un proceso y devuelve su PID.
+
+(file) nombre del archivo de pseudocódigo dentro de CodeFolder.
+Si se omite, el cuerpo del request es el pseudocódigo y se guarda en CodeFolder/uploads hasta que el proceso termine.
+El programa se valida antes de crear el proceso, uno que memoria no podría cargar se rechaza con 400.
+
+(priority) opcional, 0 es la más alta.
+*/
+func SubmitProcess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		query := r.URL.Query()
+
+		size, err := strconv.Atoi(query.Get("size"))
+		if err != nil || size < 0 {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+
+		priority := 0
+		if query.Has("priority") {
+			priority, err = strconv.Atoi(query.Get("priority"))
+			if err != nil || priority < 0 {
+				http.Error(w, "Invalid priority", http.StatusBadRequest)
+				return
+			}
+		}
+
+		path := query.Get("file")
+		if path != "" {
+			if !filepath.IsLocal(path) {
+				http.Error(w, "Invalid file", http.StatusBadRequest)
+				return
+			}
+			if _, err := os.Stat(filepath.Join(config.Values.CodeFolder, path)); err != nil {
+				http.Error(w, "File not found in code folder", http.StatusNotFound)
+				return
+			}
+		} else {
+			path, err = saveUploadedCode(r.Body)
+			if errors.Is(err, errEmptyCode) {
+				http.Error(w, "Missing file or code body", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				slog.Error("No se pudo guardar el pseudocódigo recibido", "error", err)
+				http.Error(w, "Could not save code", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := validateCode(path); err != nil {
+			if query.Get("file") == "" {
+				os.Remove(filepath.Join(config.Values.CodeFolder, path))
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pid := shared.CreateProcess(nil, path, size, priority)
+		httputils.WriteJSON(w, http.StatusOK, map[string]uint{"pid": pid})
+	}
+}
+
+var errEmptyCode = errors.New("no se recibió pseudocódigo")
+
+// validateCode interpreta el pseudocódigo de path (relativo a CodeFolder) como lo hace memoria al cargarlo.
+func validateCode(path string) error {
+	file, err := os.Open(filepath.Join(config.Values.CodeFolder, path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = codeutils.ParseCode(file)
+	return err
+}
+
+// saveUploadedCode guarda el pseudocódigo en CodeFolder/uploads y devuelve su path relativo a CodeFolder.
+func saveUploadedCode(body io.Reader) (string, error) {
+	dir := filepath.Join(config.Values.CodeFolder, shared.UploadsFolder)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, "proceso_*")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, body)
+	if err == nil && n == 0 {
+		err = errEmptyCode
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return filepath.Join(shared.UploadsFolder, filepath.Base(file.Name())), nil
+}
+
+// DELETE /process?pid= finaliza un proceso en cualquier estado.
+// El PID de un hilo principal finaliza todos sus hilos, el de un hilo secundario solo a ese hilo.
+func KillProcess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		pid, err := strconv.ParseUint(r.URL.Query().Get("pid"), 10, 0)
+		if err != nil {
+			http.Error(w, "Invalid pid", http.StatusBadRequest)
+			return
+		}
+
+		var process *globals.Process
+		for _, p := range queues.All() {
+			if p.PCB.GetPID() == uint(pid) {
+				process = p
+				break
+			}
+		}
+		if process == nil {
+			http.Error(w, "Process not found", http.StatusNotFound)
+			return
+		}
+
+		targets := []*globals.Process{process}
+		if !process.IsThread() {
+			targets = process.LiveThreads()
+		}
+		for _, target := range targets {
+			if err := Kill(target); err != nil {
+				slog.Error("No se pudo finalizar el proceso", "pid", target.PCB.GetPID(), "error", err)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("Proceso %d finalizado", pid)))
+	}
+}
+
+/*
+Kill lleva un proceso a EXIT sin importar su estado.
+
+Si está en EXEC se interrumpe su CPU y lo termina HandleReason al devolverlo.
+Si está bloqueado se saca de MTSQueue, se cancela su timer de suspensión y la IO pendiente.
+Memoria libera sus marcos o su swap en TerminateProcess.
+*/
+func Kill(process *globals.Process) error {
+	pid := process.PCB.GetPID()
+	logger.RequiredLog(true, pid, "Se solicita finalizar el proceso", map[string]string{
+		"Estado": process.PCB.GetState().String(),
+	})
+
+	// UnsuspendMutex se suelta antes de TerminateProcess, que puede finalizar a otros procesos (orphan_policy).
+	unlock := func() {}
+
+	switch process.PCB.GetState() {
+	case pcb.EXIT:
+		return errors.New("el proceso ya finalizó")
+
+	case pcb.EXEC:
+		process.Killed.Store(true)
+		if cpu := shared.GetCPUByProcess(process); cpu != nil {
+			err := shared.InterruptCPU(cpu, process.MemoryPID())
+			if err != nil {
+				process.Killed.Store(false)
+			}
+			return err
+		}
+		// Todavía no llegó a despacharse, se libera como cualquier otro.
+		shared.FreeCPU(process)
+
+	case pcb.BLOCKED, pcb.SUSP_BLOCKED:
+		globals.UnsuspendMutex.Lock()
+		unlock = globals.UnsuspendMutex.Unlock
+
+		process.Killed.Store(true)
+		if blocked := globals.RemoveBlockedByPID(pid); blocked != nil {
+			close(blocked.CancelTimer)
+		}
+
+	default:
+		process.Killed.Store(true)
+	}
+
+	moved := queues.Move(process.PCB.GetState(), pcb.EXIT, pid)
+	unlock()
+	if moved == nil {
+		return fmt.Errorf("el proceso cambió de estado (%s) mientras se finalizaba", process.PCB.GetState())
+	}
+
+	logger.RequiredLog(true, pid, "Finaliza el proceso", nil)
+	shared.TerminateProcess(process)
+	return nil
+}
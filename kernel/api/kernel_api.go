@@ -3,17 +3,26 @@ package kernel_api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"ssoo-kernel/config"
+	"ssoo-kernel/devices"
+	"ssoo-kernel/events"
 	"ssoo-kernel/globals"
+	"ssoo-kernel/messages"
 	"ssoo-kernel/queues"
+	"ssoo-kernel/resources"
 	"ssoo-kernel/shared"
+	"ssoo-utils/clock"
 	"ssoo-utils/codeutils"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
 	"ssoo-utils/pcb"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func ReceiveCPU() http.HandlerFunc {
@@ -50,14 +59,17 @@ func ReceiveCPU() http.HandlerFunc {
 			}
 		}
 
+		if config.Values.CPUAffinity {
+			globals.Processes.AddQueue(globals.CPUQueue(id), pcb.READY)
+		}
+
 		globals.AvCPUmu.Lock()
 		globals.AvailableCPUs = append(globals.AvailableCPUs, cpu)
 		globals.AvCPUmu.Unlock()
+		events.Device(events.CPUConnected, "registered", fmt.Sprintf("%s %s:%d", id, ip, port))
 
-		select {
-		case globals.CpuAvailableSignal <- struct{}{}:
+		if globals.Signal(globals.CpuAvailableSignal) {
 			slog.Debug("Nueva CPU añadida. Se desbloquea CpuAvailableSignal..")
-		default:
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -65,14 +77,27 @@ func ReceiveCPU() http.HandlerFunc {
 	}
 }
 
-func HandleReason(pid uint, pc int, reason string) {
+// HandleReason recibe el proceso que devuelve la CPU. pid es el PID en memoria y tid el hilo que corría.
+func HandleReason(pid uint, tid uint, pc int, reason string) {
 
-	process := queues.RemoveByPID(pcb.EXEC, pid)
+	// Se busca el hilo entre los que están en EXEC y no a través del principal, que puede haber
+	// terminado antes y ya no estar en la tabla (ver queues.TrimExit).
+	process := globals.Processes.PeekState(pcb.EXEC, func(running []*globals.Process) *globals.Process {
+		index := slices.IndexFunc(running, func(p *globals.Process) bool { return p.MemoryPID() == pid && p.TID == tid })
+		if index < 0 {
+			return nil
+		}
+		return running[index]
+	})
+	if process != nil {
+		process = queues.RemoveByPID(pcb.EXEC, process.PCB.GetPID())
+	}
 
 	if process == nil {
-		slog.Info("Busqueda erronea en HandleReason", " PID", fmt.Sprint(pid), " Razon", reason)
+		slog.Info("Busqueda erronea en HandleReason", " PID", fmt.Sprint(pid), " TID", fmt.Sprint(tid), " Razon", reason)
 		return
 	}
+	pid = process.PCB.GetPID()
 
 	fmt.Println(" ")
 	fmt.Println(" ")
@@ -81,18 +106,38 @@ func HandleReason(pid uint, pc int, reason string) {
 
 	process.PCB.SetPC(pc)
 	shared.FreeCPU(process)
-	globals.UpdateBurstEstimation(process)
+
+	// EXIT de cualquier hilo finaliza el proceso entero, THREAD_EXIT solo a su hilo.
+	exitProcess := reason == "Exit" && !process.Killed.Load()
+	if process.Killed.Load() {
+		reason = "Exit"
+	}
+	globals.BurstFinished(process, reason)
 
 	switch reason {
 	case "Interrupt":
+		globals.Preemptions.Inc()
 		logger.RequiredLog(true, pid, "## (%d) - Desalojado por algoritmo", map[string]string{
-			"Algoritmo": config.Values.ReadyIngressAlgorithm,
+			"Algoritmo": config.Values.SchedulerAlgorithm,
 		})
 		queues.Enqueue(pcb.READY, process)
 	case "Exit":
 		logger.RequiredLog(true, pid, "Finaliza el proceso", nil)
 		queues.Enqueue(pcb.EXIT, process)
 		shared.TerminateProcess(process)
+
+		if exitProcess {
+			killThreads(process)
+		}
+	}
+}
+
+// killThreads finaliza los hilos del proceso que siguen vivos.
+func killThreads(process *globals.Process) {
+	for _, thread := range process.LiveThreads() {
+		if err := Kill(thread); err != nil {
+			slog.Error("No se pudo finalizar el hilo", "pid", thread.PCB.GetPID(), "tid", thread.TID, "error", err)
+		}
 	}
 }
 
@@ -123,6 +168,15 @@ func ReceivePidPcReason() http.HandlerFunc {
 			return
 		}
 
+		tid := 0
+		if query.Has("tid") {
+			tid, err = strconv.Atoi(query.Get("tid"))
+			if err != nil {
+				http.Error(w, "Invalid TID", http.StatusBadRequest)
+				return
+			}
+		}
+
 		reason := query.Get("reason")
 
 		if reason != "Interrupt" && reason != "Exit" && reason != "" {
@@ -130,7 +184,7 @@ func ReceivePidPcReason() http.HandlerFunc {
 			return
 		}
 
-		HandleReason(pidUint, pcInt, reason)
+		HandleReason(pidUint, uint(tid), pcInt, reason)
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Reason received successfully"))
@@ -182,6 +236,14 @@ func RecieveSyscall() http.HandlerFunc {
 			return
 		}
 
+		if process.Killed.Load() {
+			// Se ignora, la interrupción pendiente lo finaliza en cuanto la CPU lo devuelve.
+			slog.Info("Syscall ignorada, el proceso fue finalizado", "pid", process.PCB.GetPID())
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Proceso finalizado"))
+			return
+		}
+
 		process.PCB.SetPC(processPCInt)
 
 		var instruction codeutils.Instruction
@@ -200,85 +262,352 @@ func RecieveSyscall() http.HandlerFunc {
 				"syscall": codeutils.OpcodeStrings[opcode],
 				"args":    fmt.Sprintf("%v", instruction.Args),
 			})
+		events.Process(events.Syscall, process.PCB.GetPID(), process.PCB.GetState(), process.PCB.GetState(),
+			codeutils.OpcodeStrings[opcode], strings.Join(instruction.Args, " "))
 
 		switch opcode {
 		case codeutils.IO:
 			device := instruction.Args[0]
 			timeMs, _ := strconv.Atoi(instruction.Args[1])
 
-			iosConNombre := make([]*globals.IOConnection, 0)
+			if !sendToDevice(process, opcode, device, timeMs, "") {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("Dispositivo IO no existe - process terminado"))
+				return
+			}
 
-			for _, io := range globals.AvailableIOs {
-				if io.Name == device {
-					iosConNombre = append(iosConNombre, io)
-				}
+		// IO_STDOUT e IO_STDIN las atiende una instancia STDOUT o STDIN del dispositivo, que mueve los datos con memoria.
+		case codeutils.IO_STDOUT, codeutils.IO_STDIN:
+			if len(instruction.Args) != 3 {
+				http.Error(w, "Cantidad de argumentos inválida", http.StatusBadRequest)
+				return
+			}
+			device := instruction.Args[0]
+			address, errAddress := strconv.Atoi(instruction.Args[1])
+			size, errSize := strconv.Atoi(instruction.Args[2])
+			if errAddress != nil || errSize != nil || size < 0 {
+				http.Error(w, "Dirección o tamaño inválido", http.StatusBadRequest)
+				return
 			}
 
-			if len(iosConNombre) == 0 {
-				queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
-				queues.Enqueue(pcb.EXIT, process)
-				shared.TerminateProcess(process)
+			op := fmt.Sprintf("%d|%s %d %d", process.MemoryPID(), codeutils.OpcodeStrings[opcode], address, size)
+			if !sendToDevice(process, opcode, device, 0, op) {
 				w.WriteHeader(http.StatusOK)
 				w.Write([]byte("Dispositivo IO no existe - process terminado"))
 				return
 			}
 
-			// Buscar una IO disponible
-			selectedIO := (*globals.IOConnection)(nil)
-			globals.AvIOmu.Lock()
-			for _, io := range iosConNombre {
-				if io.Disp {
-					selectedIO = io
-					io.Disp = false
-					break
-				}
+		// Las operaciones de archivos las atiende el módulo filesystem, conectado como un dispositivo de IO.
+		// Lee y escribe la memoria del proceso por su cuenta, por eso el pedido lleva el PID de memoria.
+		case codeutils.F_CREATE, codeutils.F_OPEN, codeutils.F_WRITE, codeutils.F_READ, codeutils.F_TRUNCATE, codeutils.F_DELETE:
+			if len(instruction.Args) != fileSyscallArgs[opcode] {
+				http.Error(w, "Cantidad de argumentos inválida", http.StatusBadRequest)
+				return
 			}
-			globals.AvIOmu.Unlock()
-
-			queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
-			shared.FreeCPU(process)
-			globals.UpdateBurstEstimation(process)
-
-			queues.Enqueue(pcb.BLOCKED, process)
-			logger.RequiredLog(true, process.PCB.GetPID(),
-				fmt.Sprintf("## (%d) - Bloqueado por IO: %s", process.PCB.GetPID(), device),
-				nil)
-			blocked := CreateBlocked(process, device, timeMs)
 
-			globals.MTSQueueMu.Lock()
-			globals.MTSQueue = append(globals.MTSQueue, blocked)
-			globals.MTSQueueMu.Unlock()
-			globals.UnlockMTS()
-
-			if selectedIO != nil {
-				blocked.Working = true
-			} else {
+			op := fmt.Sprintf("%d|%s %s", process.MemoryPID(), codeutils.OpcodeStrings[opcode], strings.Join(instruction.Args, " "))
+			if !sendToDevice(process, opcode, config.Values.FilesystemDevice, 0, op) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("Filesystem no conectado - process terminado"))
 				return
 			}
 
-			globals.SendIORequest(process.PCB.GetPID(), timeMs, selectedIO)
-
 		case codeutils.INIT_PROC:
+			if err := codeutils.ValidateArgs(instruction); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			codePath := instruction.Args[0]
 			size, _ := strconv.Atoi(instruction.Args[1])
-			shared.CreateProcess(codePath, size)
+			priority := 0
+			if len(instruction.Args) > 2 {
+				priority, err = strconv.Atoi(instruction.Args[2])
+				if err != nil || priority < 0 {
+					http.Error(w, "Prioridad inválida", http.StatusBadRequest)
+					return
+				}
+			}
+			shared.CreateProcess(process, codePath, size, priority)
 
 		case codeutils.DUMP_MEMORY:
 
 			queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
 			shared.FreeCPU(process)
-			globals.UpdateBurstEstimation(process)
+			globals.BurstFinished(process, codeutils.OpcodeStrings[opcode])
 
 			queues.Enqueue(pcb.BLOCKED, process)
+			process.PCB.SetStateDetail(codeutils.OpcodeStrings[opcode])
 			blocked := CreateBlocked(process, "", 0)
 			blocked.Working = true
 
-			globals.MTSQueueMu.Lock()
-			globals.MTSQueue = append(globals.MTSQueue, blocked)
-			globals.MTSQueueMu.Unlock()
+			globals.AddBlocked(blocked)
 
 			DUMP_MEMORY(process)
 
+		// WAIT y SIGNAL responden 202 si el proceso deja la CPU (se bloquea o se finaliza),
+		// con 200 la CPU sigue ejecutándolo.
+		case codeutils.WAIT:
+			name := instruction.Args[0]
+			blocked, err := resources.Wait(process, name, func() {
+				queues.RemoveByPID(pcb.EXEC, process.PCB.GetPID())
+				shared.FreeCPU(process)
+				globals.BurstFinished(process, codeutils.OpcodeStrings[opcode])
+
+				queues.Enqueue(pcb.BLOCKED, process)
+				process.PCB.SetStateDetail(name)
+				logger.RequiredLog(true, process.PCB.GetPID(),
+					fmt.Sprintf("## (%d) - Bloqueado por recurso: %s", process.PCB.GetPID(), name), nil)
+			})
+
+			if err != nil {
+				terminateByResource(process, name)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Recurso inexistente - proceso terminado"))
+				return
+			}
+			if blocked {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Proceso bloqueado esperando " + name))
+				resources.OnBlock()
+				return
+			}
+
+		case codeutils.SIGNAL:
+			name := instruction.Args[0]
+			woken, err := resources.Signal(process, name)
+
+			if err != nil {
+				terminateByResource(process, name)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Recurso inexistente - proceso terminado"))
+				return
+			}
+			if woken != nil {
+				logger.RequiredLog(true, woken.PCB.GetPID(),
+					fmt.Sprintf("## (%d) - Obtiene el recurso: %s", woken.PCB.GetPID(), name), nil)
+				shared.Wake(woken)
+			}
+
+		case codeutils.THREAD_CREATE:
+			if err := codeutils.ValidateArgs(instruction); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			priority := 0
+			if len(instruction.Args) > 1 {
+				priority, err = strconv.Atoi(instruction.Args[1])
+				if err != nil || priority < 0 {
+					http.Error(w, "Prioridad inválida", http.StatusBadRequest)
+					return
+				}
+			}
+			shared.CreateThread(process, instruction.Args[0], priority)
+
+		// THREAD_JOIN y THREAD_EXIT, igual que WAIT, responden 202 si el hilo deja la CPU.
+		case codeutils.THREAD_JOIN:
+			tid, err := strconv.Atoi(instruction.Args[0])
+			if err != nil {
+				http.Error(w, "TID inválido", http.StatusBadRequest)
+				return
+			}
+			if joinThread(process, uint(tid)) {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte(fmt.Sprintf("Hilo bloqueado esperando al hilo %d", tid)))
+				return
+			}
+
+		case codeutils.THREAD_EXIT:
+			logger.RequiredLog(true, process.PCB.GetPID(), "Finaliza el hilo", map[string]string{
+				"TID": fmt.Sprint(process.TID),
+			})
+			if queues.Move(pcb.EXEC, pcb.EXIT, process.PCB.GetPID()) != nil {
+				shared.FreeCPU(process)
+				globals.BurstFinished(process, codeutils.OpcodeStrings[opcode])
+				shared.TerminateProcess(process)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("Hilo finalizado"))
+			return
+
+		// SLEEP bloquea con un timer del kernel. Como cualquier bloqueado, el MTS lo puede suspender.
+		case codeutils.SLEEP:
+			timeMs, err := strconv.Atoi(instruction.Args[0])
+			if err != nil || timeMs < 0 {
+				http.Error(w, "Tiempo inválido", http.StatusBadRequest)
+				return
+			}
+
+			blockRunning(process, opcode, fmt.Sprintf("SLEEP %d", timeMs))
+			logger.RequiredLog(true, process.PCB.GetPID(),
+				fmt.Sprintf("## (%d) - Bloqueado por SLEEP: %d ms", process.PCB.GetPID(), timeMs), nil)
+
+			blocked := CreateBlocked(process, "", timeMs)
+			blocked.Working = true
+			blocked.Sleep = true
+			globals.AddBlocked(blocked)
+			globals.UnlockMTS()
+			sleepTimer(blocked)
+
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("Proceso bloqueado por SLEEP"))
+			return
+
+		// MSG_SEND y MSG_RECV, igual que WAIT, responden 202 si el proceso deja la CPU.
+		case codeutils.MSG_SEND, codeutils.MSG_RECV:
+			if len(instruction.Args) != 3 {
+				http.Error(w, "Cantidad de argumentos inválida", http.StatusBadRequest)
+				return
+			}
+			name := instruction.Args[0]
+			address, errAddress := strconv.Atoi(instruction.Args[1])
+			size, errSize := strconv.Atoi(instruction.Args[2])
+			if errAddress != nil || errSize != nil || size < 0 {
+				http.Error(w, "Dirección o tamaño inválido", http.StatusBadRequest)
+				return
+			}
+
+			exchange := messages.Send
+			if opcode == codeutils.MSG_RECV {
+				exchange = messages.Receive
+			}
+			blocked, woken, err := exchange(process, name, address, size, func() {
+				blockRunning(process, opcode, codeutils.OpcodeStrings[opcode]+" "+name)
+				logger.RequiredLog(true, process.PCB.GetPID(),
+					fmt.Sprintf("## (%d) - Bloqueado por cola de mensajes: %s", process.PCB.GetPID(), name), nil)
+			})
+			if woken != nil {
+				shared.Wake(woken)
+			}
+
+			if err != nil {
+				terminateByMessage(process, name, err)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Error en la cola de mensajes - proceso terminado"))
+				return
+			}
+			if blocked {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Proceso bloqueado en la cola " + name))
+				return
+			}
+
+		// SHM_ATTACH y SHM_DETACH no bloquean, responden 202 solo si memoria rechaza el pedido y se finaliza el proceso.
+		// La dirección del segmento depende del orden de los SHM_ATTACH y los MALLOC, se le devuelve al programa
+		// en el destino opcional igual que en MALLOC.
+		case codeutils.SHM_ATTACH, codeutils.SHM_DETACH:
+			if err := codeutils.ValidateArgs(instruction); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			name := instruction.Args[0]
+			size := 0
+			destination := -1
+			if opcode == codeutils.SHM_ATTACH {
+				var err error
+				var ok bool
+				size, err = strconv.Atoi(instruction.Args[1])
+				if err != nil || size <= 0 {
+					http.Error(w, "Tamaño inválido", http.StatusBadRequest)
+					return
+				}
+				if destination, ok = resultDestination(instruction.Args[2:]); !ok {
+					http.Error(w, "Destino inválido", http.StatusBadRequest)
+					return
+				}
+			}
+
+			address, err := requestSharedMemory(process, opcode, name, size)
+			if err == nil && destination >= 0 {
+				err = shared.WriteResult(process, destination, address)
+			}
+			if err != nil {
+				terminateByMemory(process, opcode, err)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Error en el segmento compartido - proceso terminado"))
+				return
+			}
+			if opcode == codeutils.SHM_ATTACH {
+				logger.RequiredLog(true, process.PCB.GetPID(), "Segmento compartido mapeado", map[string]string{
+					"Segmento":   name,
+					"Dir.Lógica": address,
+				})
+			} else {
+				logger.RequiredLog(true, process.PCB.GetPID(), "Segmento compartido desmapeado", map[string]string{
+					"Segmento": name,
+				})
+				// Si era el último proceso que lo usaba se liberaron marcos, puede haber pedidos esperando memoria.
+				globals.UnlockMTS()
+			}
+
+		// MALLOC, igual que WAIT, responde 202 si el hilo se bloquea esperando memoria o se finaliza.
+		// La memoria nueva empieza donde terminaba el espacio de direcciones del proceso,
+		// la dirección se le devuelve al programa en el destino opcional (ver codeutils.ResultSize).
+		case codeutils.MALLOC:
+			if err := codeutils.ValidateArgs(instruction); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			size, err := strconv.Atoi(instruction.Args[0])
+			if err != nil || size <= 0 {
+				http.Error(w, "Tamaño inválido", http.StatusBadRequest)
+				return
+			}
+			destination, ok := resultDestination(instruction.Args[1:])
+			if !ok {
+				http.Error(w, "Destino inválido", http.StatusBadRequest)
+				return
+			}
+
+			address, blocked, err := shared.Malloc(process, size, destination, func() {
+				blockRunning(process, opcode, fmt.Sprintf("MALLOC %d", size))
+				logger.RequiredLog(true, process.PCB.GetPID(),
+					fmt.Sprintf("## (%d) - Bloqueado por MALLOC: sin memoria para %d bytes", process.PCB.GetPID(), size), nil)
+			})
+			if err != nil {
+				terminateByMemory(process, opcode, err)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Error en MALLOC - proceso terminado"))
+				return
+			}
+			if blocked {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Proceso bloqueado esperando memoria"))
+				return
+			}
+			logger.RequiredLog(true, process.PCB.GetPID(), "Memoria dinámica asignada", map[string]string{
+				"Dir.Lógica": address,
+			})
+
+		// Sin argumento espera a cualquier hijo. Igual que THREAD_JOIN, responde 202 si el hilo se bloquea.
+		case codeutils.WAIT_CHILD:
+			var child uint
+			any := len(instruction.Args) == 0 || instruction.Args[0] == ""
+			if !any {
+				pid, err := strconv.ParseUint(instruction.Args[0], 10, 0)
+				if err != nil {
+					http.Error(w, "PID inválido", http.StatusBadRequest)
+					return
+				}
+				child = uint(pid)
+			}
+
+			label := "cualquiera"
+			if !any {
+				label = fmt.Sprint(child)
+			}
+			blocked := shared.WaitChild(process, child, any, func() {
+				blockRunning(process, opcode, "WAIT_CHILD "+label)
+				logger.RequiredLog(true, process.PCB.GetPID(),
+					fmt.Sprintf("## (%d) - Bloqueado esperando a un hijo", process.PCB.GetPID()), map[string]string{
+						"Hijo": label,
+					})
+			})
+			if blocked {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("Proceso bloqueado esperando a un hijo"))
+				return
+			}
+
 		case codeutils.EXIT:
 			process := queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
 			queues.Enqueue(pcb.EXIT, process)
@@ -294,6 +623,168 @@ func RecieveSyscall() http.HandlerFunc {
 	}
 }
 
+/*
+joinThread bloquea al hilo en EXEC hasta que termine el hilo tid de su proceso.
+
+Si ese hilo no existe, ya terminó o es el mismo, no se bloquea y devuelve false.
+Se bloquea con ThreadsMutex tomado, así TerminateProcess siempre lo encuentra en BLOCKED al despertarlo.
+*/
+func joinThread(process *globals.Process, tid uint) bool {
+	target := process.Thread(tid)
+
+	globals.ThreadsMutex.Lock()
+	defer globals.ThreadsMutex.Unlock()
+
+	if target == nil || target == process || target.PCB.GetState() == pcb.EXIT {
+		slog.Debug("THREAD_JOIN - No hay que esperar al hilo", "pid", process.PCB.GetPID(), "tid", tid)
+		return false
+	}
+
+	target.Joiners = append(target.Joiners, process)
+
+	blockRunning(process, codeutils.THREAD_JOIN, fmt.Sprintf("THREAD_JOIN %d", tid))
+	logger.RequiredLog(true, process.PCB.GetPID(),
+		fmt.Sprintf("## (%d) - Bloqueado esperando al hilo: %d", process.PCB.GetPID(), tid), nil)
+	return true
+}
+
+// sleepTimer despierta al proceso bloqueado por SLEEP cuando pasa su tiempo: a READY, o a SUSP_READY si el MTS lo suspendió.
+// El timer se crea antes de volver, así el tiempo del SLEEP cuenta desde la syscall.
+func sleepTimer(blocked *globals.Blocked) {
+	timer := clock.NewTimer(time.Duration(blocked.Time) * time.Millisecond)
+	go func() {
+		defer timer.Done()
+		select {
+		case <-timer.C:
+		case <-blocked.CancelTimer:
+			return
+		}
+		wakeFromSleep(blocked)
+	}()
+}
+
+func wakeFromSleep(blocked *globals.Blocked) {
+	globals.UnsuspendMutex.Lock()
+	defer globals.UnsuspendMutex.Unlock()
+	if globals.RemoveBlocked(func(b *globals.Blocked) bool { return b == blocked }) == nil {
+		return
+	}
+
+	pid := blocked.Process.PCB.GetPID()
+	logger.RequiredLog(true, pid, fmt.Sprintf("## (%d) finalizó SLEEP", pid), nil)
+
+	if queues.Move(pcb.BLOCKED, pcb.READY, pid) != nil {
+		globals.UnlockSTS()
+	} else if queues.Move(pcb.SUSP_BLOCKED, pcb.SUSP_READY, pid) != nil {
+		globals.UnlockMTS()
+	}
+}
+
+// terminateByMessage finaliza al proceso en EXEC que usó una cola inexistente o un rango de memoria inválido.
+func terminateByMessage(process *globals.Process, name string, err error) {
+	logger.RequiredLog(true, process.PCB.GetPID(), "Error en la cola de mensajes, se finaliza el proceso", map[string]string{
+		"Cola":  name,
+		"Error": err.Error(),
+	})
+	terminateRunning(process)
+}
+
+// terminateByMemory finaliza al proceso en EXEC al que memoria le rechazó la syscall opcode.
+func terminateByMemory(process *globals.Process, opcode codeutils.Opcode, err error) {
+	logger.RequiredLog(true, process.PCB.GetPID(), "Memoria rechazó la syscall, se finaliza el proceso", map[string]string{
+		"Syscall": codeutils.OpcodeStrings[opcode],
+		"Error":   err.Error(),
+	})
+	terminateRunning(process)
+}
+
+// terminateRunning finaliza al proceso en EXEC desde una syscall, la CPU lo saca al recibir 202.
+func terminateRunning(process *globals.Process) {
+	if queues.Move(pcb.EXEC, pcb.EXIT, process.PCB.GetPID()) == nil {
+		return
+	}
+	shared.FreeCPU(process)
+	globals.BurstFinished(process, "Exit")
+	shared.TerminateProcess(process)
+}
+
+var fileSyscallArgs = map[codeutils.Opcode]int{
+	codeutils.F_CREATE:   1,
+	codeutils.F_OPEN:     1,
+	codeutils.F_WRITE:    4,
+	codeutils.F_READ:     4,
+	codeutils.F_TRUNCATE: 2,
+	codeutils.F_DELETE:   1,
+}
+
+/*
+sendToDevice bloquea al proceso en EXEC esperando el dispositivo device y encola el pedido en la cola del dispositivo.
+
+Si hay una instancia libre lo atiende ahora, si no espera en la cola hasta que la política lo elija (ver devices).
+Si no hay ninguna instancia conectada finaliza al proceso y devuelve false.
+*/
+func sendToDevice(process *globals.Process, opcode codeutils.Opcode, device string, timeMs int, op string) bool {
+	iosConNombre := make([]*globals.IOConnection, 0)
+
+	for _, io := range globals.AvailableIOs {
+		if io.Name == device {
+			iosConNombre = append(iosConNombre, io)
+		}
+	}
+
+	if len(iosConNombre) == 0 {
+		queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
+		queues.Enqueue(pcb.EXIT, process)
+		shared.TerminateProcess(process)
+		return false
+	}
+
+	queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
+	shared.FreeCPU(process)
+	globals.BurstFinished(process, codeutils.OpcodeStrings[opcode])
+
+	queues.Enqueue(pcb.BLOCKED, process)
+	process.PCB.SetStateDetail(device)
+	logger.RequiredLog(true, process.PCB.GetPID(),
+		fmt.Sprintf("## (%d) - Bloqueado por IO: %s", process.PCB.GetPID(), device),
+		nil)
+	blocked := CreateBlocked(process, device, timeMs)
+	blocked.Op = op
+
+	globals.AddBlocked(blocked)
+	globals.UnlockMTS()
+
+	devices.Enqueue(blocked)
+	return true
+}
+
+// resultDestination devuelve el destino opcional de una syscall que devuelve una dirección, -1 si no hay.
+func resultDestination(args []string) (int, bool) {
+	if len(args) == 0 {
+		return -1, true
+	}
+	destination, err := strconv.Atoi(args[0])
+	return destination, err == nil && destination >= 0
+}
+
+// blockRunning pasa a BLOCKED al hilo en EXEC que se bloquea por la syscall opcode.
+func blockRunning(process *globals.Process, opcode codeutils.Opcode, detail string) {
+	queues.RemoveByPID(pcb.EXEC, process.PCB.GetPID())
+	shared.FreeCPU(process)
+	globals.BurstFinished(process, codeutils.OpcodeStrings[opcode])
+
+	queues.Enqueue(pcb.BLOCKED, process)
+	process.PCB.SetStateDetail(detail)
+}
+
+// terminateByResource finaliza al proceso en EXEC que pidió un recurso que no está en la configuración.
+func terminateByResource(process *globals.Process, name string) {
+	logger.RequiredLog(true, process.PCB.GetPID(), "Recurso inexistente, se finaliza el proceso", map[string]string{
+		"Recurso": name,
+	})
+	terminateRunning(process)
+}
+
 func CreateBlocked(process *globals.Process, name string, time int) *globals.Blocked {
 	blocked := new(globals.Blocked)
 	blocked.Process = process
@@ -308,51 +799,77 @@ func CreateBlocked(process *globals.Process, name string, time int) *globals.Blo
 
 func DUMP_MEMORY(process *globals.Process) {
 
+	clock.Hold()
 	go func(p *globals.Process) {
+		defer clock.Release()
 		success := HandleDumpMemory(p)
 
+		if p.Killed.Load() {
+			return
+		}
+
+		globals.RemoveBlockedByPID(p.PCB.GetPID())
+
 		if success {
 			slog.Info("Proceso desbloqueado tras syscall DUMP_MEMORY exitosa", "pid", p.PCB.GetPID())
 
-			removedProcess := queues.RemoveByPID(p.PCB.GetState(), p.PCB.GetPID())
-
-			if removedProcess == nil {
+			if queues.Move(pcb.BLOCKED, pcb.READY, p.PCB.GetPID()) == nil {
 				return
 			}
 
-			for i, blocked := range globals.MTSQueue {
-				if blocked.Process.PCB.GetPID() == p.PCB.GetPID() {
-					globals.MTSQueueMu.Lock()
-					globals.MTSQueue = append(globals.MTSQueue[:i], globals.MTSQueue[i+1:]...)
-					globals.MTSQueueMu.Unlock()
-					break
-				}
-			}
-
-			queues.Enqueue(pcb.READY, p)
-
-			for _, process := range globals.ReadyQueue {
-				slog.Debug("Proceso en READY tras DUMP_MEMORY", "pid", process.PCB.GetPID())
-			}
-
 			globals.UnlockMTS()
 		} else {
 			slog.Info("Proceso pasa a EXIT por fallo en DUMP_MEMORY", "pid", p.PCB.GetPID())
 
-			removedProcess := queues.RemoveByPID(p.PCB.GetState(), p.PCB.GetPID())
-
-			if removedProcess == nil {
+			if queues.Move(pcb.BLOCKED, pcb.EXIT, p.PCB.GetPID()) == nil {
 				return
 			}
 
-			queues.Enqueue(pcb.EXIT, p)
 			shared.TerminateProcess(p)
 		}
 	}(process)
 }
 
+// requestSharedMemory le pide a memoria adjuntar o desadjuntar el segmento name. Al adjuntar devuelve la dirección lógica del segmento.
+func requestSharedMemory(process *globals.Process, opcode codeutils.Opcode, name string, size int) (string, error) {
+	queries := map[string]string{
+		"pid":  fmt.Sprint(process.MemoryPID()),
+		"name": name,
+	}
+	method := http.MethodDelete
+	if opcode == codeutils.SHM_ATTACH {
+		queries["size"] = fmt.Sprint(size)
+		method = http.MethodPost
+	}
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpMemory,
+		Port:     config.Values.PortMemory,
+		Endpoint: "shared_memory",
+		Queries:  queries,
+	})
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error al llamar a Memoria: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("memoria rechazó el pedido (código %d): %s", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
 func HandleDumpMemory(process *globals.Process) bool {
-	pid := process.PCB.GetPID()
+	pid := process.MemoryPID()
 	url := httputils.BuildUrl(httputils.URLData{
 		Ip:       config.Values.IpMemory,
 		Port:     config.Values.PortMemory,
@@ -384,7 +901,7 @@ func RequestSuspend(process *globals.Process) error {
 		Port:     config.Values.PortMemory,
 		Endpoint: "suspend",
 		Queries: map[string]string{
-			"pid": strconv.Itoa(int(process.PCB.GetPID())),
+			"pid": strconv.Itoa(int(process.MemoryPID())),
 		},
 	})
 
@@ -401,13 +918,12 @@ func RequestSuspend(process *globals.Process) error {
 		return fmt.Errorf("swap request failed with status code %d", resp.StatusCode)
 	}
 
-	select {
-	case globals.MTSEmpty <- struct{}{}:
+	if globals.Signal(globals.MTSEmpty) {
 		slog.Debug("Se desbloquea MTS porque se realizó un swap exitoso")
-	default:
 	}
 
 	process.InMemory = false
+	events.Process(events.Suspended, process.PCB.GetPID(), process.PCB.GetState(), process.PCB.GetState(), "swap_out", "")
 
 	return nil
 }
@@ -421,7 +937,7 @@ func Unsuspend(process *globals.Process) bool {
 		Port:     config.Values.PortMemory,
 		Endpoint: "unsuspend",
 		Queries: map[string]string{
-			"pid": strconv.Itoa(int(process.PCB.GetPID())),
+			"pid": strconv.Itoa(int(process.MemoryPID())),
 		},
 	})
 
@@ -439,6 +955,7 @@ func Unsuspend(process *globals.Process) bool {
 
 	process.InMemory = true
 	slog.Info("Solicitud de unsuspend enviada correctamente", "pid", process.PCB.GetPID())
+	events.Process(events.Unsuspended, process.PCB.GetPID(), process.PCB.GetState(), process.PCB.GetState(), "swap_in", "")
 
 	return true
 }
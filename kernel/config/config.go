@@ -18,6 +18,25 @@ type KernelConfig struct {
 	LogLevel              slog.Level `json:"log_level"`
 	CodeFolder            string     `json:"code_folder"`
 	InitialEstimate       int64    `json:"initial_estimate"`
+	Quantum               int64      `json:"quantum"`
+	MLFQQuanta            []int64    `json:"mlfq_quanta"`
+	MLFQBoostInterval     int64      `json:"mlfq_boost_interval"`
+	PriorityPreemption    bool       `json:"priority_preemption"`
+	AgingInterval         int64      `json:"aging_interval"`
+	ClockMode             string     `json:"clock_mode"`
+	Daemon                bool       `json:"daemon"`
+	ExitHistory           int        `json:"exit_history"`
+	TimelineFolder        string     `json:"timeline_folder"`
+	CPUAffinity           bool       `json:"cpu_affinity"`
+	Resources             map[string]int `json:"resources"`
+	DeadlockDetection     string     `json:"deadlock_detection"`
+	DeadlockInterval      int64      `json:"deadlock_interval"`
+	DeadlockVictim        string     `json:"deadlock_victim"`
+	OrphanPolicy          string     `json:"orphan_policy"`
+	MessageQueues         map[string]int `json:"message_queues"`
+	FilesystemDevice      string     `json:"filesystem_device"`
+	IOPolicy              string     `json:"io_policy"`
+	IOPolicies            map[string]string `json:"io_policies"`
 }
 
 var Values KernelConfig
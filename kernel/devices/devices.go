@@ -0,0 +1,265 @@
+package devices
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/clock"
+	"ssoo-utils/metrics"
+	"sync"
+	"time"
+)
+
+/*
+Colas de pedidos de IO, una por nombre de dispositivo.
+
+Todos los pedidos de un dispositivo esperan en su cola y la política del dispositivo elige cuál sale:
+  - FIFO: en orden de llegada.
+  - SRF: el de menor tiempo de IO primero (shortest-request-first).
+  - PRIORITY: el del proceso con mejor prioridad (menor número) primero.
+
+En las dos últimas los empates se resuelven por orden de llegada.
+Las instancias libres de un dispositivo esperan pedidos en su long-poll de /io-notify. Si hay varias libres
+el pedido va a la que menos pedidos atendió, así la carga se reparte entre todas las que comparten el nombre.
+*/
+
+const (
+	FIFO     = "FIFO"
+	SRF      = "SRF"
+	PRIORITY = "PRIORITY"
+)
+
+type request struct {
+	blocked  *globals.Blocked
+	enqueued time.Time
+}
+
+type device struct {
+	name   string
+	policy string
+	queue  []request
+	idle   []*globals.IOConnection // instancias esperando un pedido, en orden de llegada
+
+	dispatched int
+	totalWait  time.Duration
+	maxWait    time.Duration
+}
+
+// Stats es el estado de la cola de un dispositivo.
+type Stats struct {
+	Policy     string  `json:"policy"`
+	Depth      int     `json:"depth"`
+	Idle       int     `json:"idle"`
+	Dispatched int     `json:"dispatched"`
+	AvgWaitMs  float64 `json:"avg_wait_ms"`
+	MaxWaitMs  int64   `json:"max_wait_ms"`
+}
+
+var (
+	mu      sync.Mutex
+	devices = make(map[string]*device)
+)
+
+var (
+	dispatchedTotal = metrics.NewCounterVec("ssoo_kernel_io_dispatched_total", "Pedidos de IO despachados a una instancia.", "device")
+	waitSeconds     = metrics.NewCounterVec("ssoo_kernel_io_wait_seconds_total", "Tiempo esperado en la cola del dispositivo por los pedidos despachados.", "device")
+)
+
+func init() {
+	metrics.NewGaugeVecFunc("ssoo_kernel_io_queue_depth", "Pedidos esperando en la cola de cada dispositivo.", "device", func() map[string]float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		depths := make(map[string]float64)
+		for name, device := range devices {
+			depths[name] = float64(len(device.queue))
+		}
+		return depths
+	})
+}
+
+// Init valida las políticas de la configuración: io_policy para todos los dispositivos e io_policies por nombre.
+func Init() error {
+	for _, policy := range config.Values.IOPolicies {
+		if err := validatePolicy(policy); err != nil {
+			return err
+		}
+	}
+	return validatePolicy(config.Values.IOPolicy)
+}
+
+func validatePolicy(policy string) error {
+	switch policy {
+	case "", FIFO, SRF, PRIORITY:
+		return nil
+	}
+	return fmt.Errorf("política de IO desconocida: %s", policy)
+}
+
+// get devuelve la cola del dispositivo name, creándola si no existe. Requiere el lock tomado.
+func get(name string) *device {
+	if d, exists := devices[name]; exists {
+		return d
+	}
+	policy := cmp.Or(config.Values.IOPolicies[name], config.Values.IOPolicy, FIFO)
+	d := &device{name: name, policy: policy}
+	devices[name] = d
+	return d
+}
+
+// Enqueue encola el pedido del proceso bloqueado y, si hay una instancia libre del dispositivo, le despacha el próximo según la política.
+func Enqueue(blocked *globals.Blocked) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d := get(blocked.Name)
+	d.queue = append(d.queue, request{blocked, clock.Now()})
+	slog.Debug("Pedido de IO encolado", "pid", blocked.Process.PCB.GetPID(), "device", d.name, "depth", len(d.queue))
+	d.dispatchIdle()
+}
+
+// Requeue devuelve al frente de la cola el pedido despachado a una instancia que se desconectó sin leerlo
+// y, si hay otra instancia libre, se lo despacha. El trabajo del reloj del despacho original lo suelta quien llama.
+func Requeue(io *globals.IOConnection, req globals.IORequest) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var blocked *globals.Blocked
+	globals.MTSQueueMu.Lock()
+	for _, other := range globals.MTSQueue {
+		if other.Name == io.Name && other.Process.PCB.GetPID() == req.Pid {
+			blocked = other
+			blocked.Working = false
+			break
+		}
+	}
+	globals.MTSQueueMu.Unlock()
+	if blocked == nil {
+		// El proceso se finalizó mientras tanto.
+		return
+	}
+
+	d := get(io.Name)
+	d.queue = slices.Insert(d.queue, 0, request{blocked, clock.Now()})
+	slog.Debug("Pedido de IO devuelto a la cola", "pid", req.Pid, "device", d.name, "depth", len(d.queue))
+	d.dispatchIdle()
+}
+
+// dispatchIdle despacha el próximo pedido a la instancia libre que menos pedidos atendió, si hay alguna. Requiere el lock tomado.
+func (d *device) dispatchIdle() {
+	if len(d.idle) == 0 {
+		return
+	}
+	instance := slices.MinFunc(d.idle, func(a, b *globals.IOConnection) int { return cmp.Compare(a.Served, b.Served) })
+	d.idle = slices.DeleteFunc(d.idle, func(io *globals.IOConnection) bool { return io == instance })
+	instance.Handler <- d.dispatch(instance)
+}
+
+// Next devuelve el próximo pedido para la instancia. Si la cola está vacía la instancia queda libre
+// y devuelve false: el pedido le llega después por io.Handler (ver Enqueue).
+func Next(io *globals.IOConnection) (globals.IORequest, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Un pedido despachado a un long-poll que se cortó antes de leerlo sigue en el canal.
+	select {
+	case request := <-io.Handler:
+		return request, true
+	default:
+	}
+
+	d := get(io.Name)
+	if len(d.queue) == 0 {
+		if !slices.Contains(d.idle, io) {
+			d.idle = append(d.idle, io)
+		}
+		io.Disp = true
+		return globals.IORequest{}, false
+	}
+	return d.dispatch(io), true
+}
+
+// dispatch saca de la cola el pedido que elige la política y se lo asigna a la instancia. Requiere el lock tomado y la cola no vacía.
+// El pedido lleva un trabajo del reloj que la instancia suelta después de avisar que terminó.
+func (d *device) dispatch(io *globals.IOConnection) globals.IORequest {
+	clock.Hold()
+
+	index := 0
+	switch d.policy {
+	case SRF:
+		index = pickMin(d.queue, func(r request) int { return r.blocked.Time })
+	case PRIORITY:
+		index = pickMin(d.queue, func(r request) int { return r.blocked.Process.Priority })
+	}
+	next := d.queue[index]
+	d.queue = slices.Delete(d.queue, index, index+1)
+
+	wait := clock.Since(next.enqueued)
+	d.dispatched++
+	d.totalWait += wait
+	d.maxWait = max(d.maxWait, wait)
+	dispatchedTotal.With(d.name).Inc()
+	waitSeconds.With(d.name).Add(wait.Seconds())
+
+	io.Disp = false
+	io.Served++
+	globals.MTSQueueMu.Lock()
+	next.blocked.Working = true
+	globals.MTSQueueMu.Unlock()
+
+	pid := next.blocked.Process.PCB.GetPID()
+	slog.Debug("Pedido de IO despachado", "pid", pid, "device", d.name, "instancia", io.IP+":"+io.Port, "espera", wait, "depth", len(d.queue))
+	return globals.IORequest{Pid: pid, Timer: next.blocked.Time, Op: next.blocked.Op}
+}
+
+// pickMin devuelve el índice del primer pedido con menor valor según key.
+func pickMin(queue []request, key func(request) int) int {
+	index := 0
+	for i, r := range queue {
+		if key(r) < key(queue[index]) {
+			index = i
+		}
+	}
+	return index
+}
+
+// Disconnect saca a la instancia de las libres de su dispositivo.
+func Disconnect(io *globals.IOConnection) {
+	mu.Lock()
+	defer mu.Unlock()
+	if d, exists := devices[io.Name]; exists {
+		d.idle = slices.DeleteFunc(d.idle, func(other *globals.IOConnection) bool { return other == io })
+	}
+}
+
+// Remove descarta los pedidos pendientes del proceso, lo llama TerminateProcess.
+func Remove(process *globals.Process) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, d := range devices {
+		d.queue = slices.DeleteFunc(d.queue, func(r request) bool { return r.blocked.Process == process })
+	}
+}
+
+// Snapshot devuelve el estado de la cola de cada dispositivo que recibió algún pedido o instancia.
+func Snapshot() map[string]Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	stats := make(map[string]Stats, len(devices))
+	for name, d := range devices {
+		s := Stats{
+			Policy:     d.policy,
+			Depth:      len(d.queue),
+			Idle:       len(d.idle),
+			Dispatched: d.dispatched,
+			MaxWaitMs:  d.maxWait.Milliseconds(),
+		}
+		if d.dispatched > 0 {
+			s.AvgWaitMs = float64(d.totalWait.Milliseconds()) / float64(d.dispatched)
+		}
+		stats[name] = s
+	}
+	return stats
+}
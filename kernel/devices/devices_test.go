@@ -0,0 +1,185 @@
+package devices
+
+import (
+	"slices"
+	"ssoo-kernel/globals"
+	"ssoo-utils/pcb"
+	"testing"
+)
+
+// setDevices reemplaza las colas de dispositivos por una sola, name con la política policy y las instancias libres idle.
+func setDevices(t *testing.T, name string, policy string, idle ...*globals.IOConnection) *device {
+	mu.Lock()
+	defer mu.Unlock()
+	previous := devices
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		devices = previous
+	})
+
+	d := &device{name: name, policy: policy, idle: idle}
+	devices = map[string]*device{name: d}
+	return d
+}
+
+func newBlocked(pid uint, name string, time int, priority int) *globals.Blocked {
+	process := &globals.Process{PCB: pcb.Create(pid, "test"), Priority: priority}
+	return &globals.Blocked{Process: process, Name: name, Time: time}
+}
+
+func newInstance(port string, served int) *globals.IOConnection {
+	return &globals.IOConnection{Name: "disco", Port: port, Handler: make(chan globals.IORequest, 1), Served: served}
+}
+
+func TestDispatchOrder(t *testing.T) {
+	// Pedidos en orden de llegada: pid, tiempo de IO, prioridad del proceso.
+	arrivals := []struct {
+		pid      uint
+		time     int
+		priority int
+	}{
+		{1, 300, 2},
+		{2, 100, 1},
+		{3, 200, 1},
+		{4, 100, 0},
+	}
+
+	cases := []struct {
+		policy string
+		want   []uint
+	}{
+		{FIFO, []uint{1, 2, 3, 4}},
+		{SRF, []uint{2, 4, 3, 1}},      // 2 y 4 empatan en 100, sale primero 2 que llegó antes
+		{PRIORITY, []uint{4, 2, 3, 1}}, // 2 y 3 empatan en 1, sale primero 2 que llegó antes
+	}
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			d := &device{name: "disco", policy: c.policy}
+			for _, a := range arrivals {
+				d.queue = append(d.queue, request{blocked: newBlocked(a.pid, "disco", a.time, a.priority)})
+			}
+
+			got := make([]uint, 0, len(arrivals))
+			for len(d.queue) > 0 {
+				got = append(got, d.dispatch(newInstance("1", 0)).Pid)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Errorf("orden %v, se esperaba %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPickMinTieBreak(t *testing.T) {
+	queue := []request{
+		{blocked: newBlocked(1, "disco", 50, 0)},
+		{blocked: newBlocked(2, "disco", 10, 0)},
+		{blocked: newBlocked(3, "disco", 10, 0)},
+	}
+	if got := pickMin(queue, func(r request) int { return r.blocked.Time }); got != 1 {
+		t.Errorf("pickMin = %d, se esperaba 1", got)
+	}
+	if got := pickMin(queue, func(r request) int { return r.blocked.Process.Priority }); got != 0 {
+		t.Errorf("pickMin con todos empatados = %d, se esperaba 0", got)
+	}
+	if got := pickMin(queue[:1], func(r request) int { return r.blocked.Time }); got != 0 {
+		t.Errorf("pickMin de un solo pedido = %d, se esperaba 0", got)
+	}
+}
+
+func TestEnqueueLeastServed(t *testing.T) {
+	cases := []struct {
+		name   string
+		served []int // pedidos atendidos por cada instancia libre, en orden de llegada
+		want   int   // instancia que recibe el pedido, -1 si ninguna
+	}{
+		{"sin instancias libres", nil, -1},
+		{"una sola", []int{5}, 0},
+		{"la que menos atendió", []int{3, 1, 2}, 1},
+		{"empate va a la que llegó primero", []int{2, 1, 1}, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			idle := make([]*globals.IOConnection, 0, len(c.served))
+			for i, served := range c.served {
+				idle = append(idle, newInstance(string(rune('0'+i)), served))
+			}
+			d := setDevices(t, "disco", FIFO, slices.Clone(idle)...)
+
+			Enqueue(newBlocked(1, "disco", 100, 0))
+
+			for i, instance := range idle {
+				select {
+				case request := <-instance.Handler:
+					if i != c.want {
+						t.Errorf("la instancia %d recibió el pedido, se esperaba %d", i, c.want)
+					}
+					if request.Pid != 1 || request.Timer != 100 {
+						t.Errorf("pedido %+v, se esperaba pid 1 y 100 ms", request)
+					}
+					if instance.Served != c.served[i]+1 {
+						t.Errorf("la instancia atendió %d, se esperaba %d", instance.Served, c.served[i]+1)
+					}
+					if slices.Contains(d.idle, instance) {
+						t.Errorf("la instancia %d sigue libre después de recibir el pedido", i)
+					}
+				default:
+					if i == c.want {
+						t.Errorf("la instancia %d no recibió el pedido", i)
+					}
+				}
+			}
+
+			wantDepth := 0
+			if c.want == -1 {
+				wantDepth = 1
+			}
+			if len(d.queue) != wantDepth {
+				t.Errorf("quedaron %d pedidos en la cola, se esperaban %d", len(d.queue), wantDepth)
+			}
+		})
+	}
+}
+
+func TestRequeueGoesFirst(t *testing.T) {
+	d := setDevices(t, "disco", FIFO)
+	dropped := newInstance("1", 0)
+	blocked := newBlocked(1, "disco", 300, 0)
+	blocked.Working = true
+	globals.AddBlocked(blocked)
+	t.Cleanup(func() { globals.RemoveBlockedByPID(1) })
+
+	d.queue = append(d.queue, request{blocked: newBlocked(2, "disco", 100, 0)})
+	Requeue(dropped, globals.IORequest{Pid: 1, Timer: 300})
+
+	if blocked.Working {
+		t.Error("el proceso sigue marcado como atendido")
+	}
+	if len(d.queue) != 2 || d.queue[0].blocked != blocked {
+		t.Fatalf("el pedido no volvió al frente de la cola")
+	}
+
+	// Con otra instancia libre se le despacha en el momento.
+	other := newInstance("2", 0)
+	d.queue = d.queue[1:]
+	d.idle = []*globals.IOConnection{other}
+	blocked.Working = true
+	Requeue(dropped, globals.IORequest{Pid: 1, Timer: 300})
+	select {
+	case request := <-other.Handler:
+		if request.Pid != 1 {
+			t.Errorf("se despachó el pid %d, se esperaba 1", request.Pid)
+		}
+	default:
+		t.Error("la instancia libre no recibió el pedido devuelto")
+	}
+
+	// Si el proceso ya no está bloqueado el pedido se descarta.
+	globals.RemoveBlockedByPID(1)
+	depth := len(d.queue)
+	Requeue(dropped, globals.IORequest{Pid: 1, Timer: 300})
+	if len(d.queue) != depth {
+		t.Error("se encoló el pedido de un proceso que ya no está bloqueado")
+	}
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"ssoo-utils/clock"
+	"ssoo-utils/pcb"
+	"sync"
+	"time"
+)
+
+/*
+Eventos del kernel publicados en vivo por /events (Server-Sent Events).
+
+Cada suscriptor tiene un buffer propio; si no lo lee a tiempo se descartan sus eventos
+en vez de frenar al planificador.
+*/
+
+type Type string
+
+const (
+	StateChanged   Type = "state_changed"
+	Syscall        Type = "syscall"
+	CPUConnected   Type = "cpu_connected"
+	IOConnected    Type = "io_connected"
+	IODisconnected Type = "io_disconnected"
+	Suspended      Type = "suspended"
+	Unsuspended    Type = "unsuspended"
+)
+
+type Event struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Type   Type      `json:"type"`
+	PID    *uint     `json:"pid,omitempty"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	Reason string    `json:"reason"`
+	Detail string    `json:"detail,omitempty"` // argumentos de la syscall, CPU o dispositivo IO
+}
+
+const subscriberBuffer = 256
+
+var (
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers = make(map[chan Event]struct{})
+)
+
+// Publish le manda el evento a todos los suscriptores. Completa el ID y el instante.
+func Publish(event Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nextID++
+	event.ID = nextID
+	event.Time = clock.Now()
+
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			slog.Warn("Suscriptor de eventos lento, se descarta el evento", "id", event.ID, "type", event.Type)
+		}
+	}
+}
+
+// Process publica un evento de un proceso que pasa del estado from al estado to.
+func Process(kind Type, pid uint, from pcb.STATE, to pcb.STATE, reason string, detail string) {
+	Publish(Event{Type: kind, PID: &pid, From: from.String(), To: to.String(), Reason: reason, Detail: detail})
+}
+
+// Device publica la conexión o desconexión de una CPU o una instancia de IO.
+func Device(kind Type, reason string, detail string) {
+	Publish(Event{Type: kind, Reason: reason, Detail: detail})
+}
+
+func Subscribe() chan Event {
+	mu.Lock()
+	defer mu.Unlock()
+	subscriber := make(chan Event, subscriberBuffer)
+	subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func Unsubscribe(subscriber chan Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(subscribers, subscriber)
+}
+
+// Handler sirve GET /events como un stream SSE hasta que el cliente se desconecta o ctx se cancela.
+func Handler(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		subscriber := Subscribe()
+		defer Unsubscribe(subscriber)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		slog.Info("Nuevo suscriptor de eventos", "remote", r.RemoteAddr)
+
+		for {
+			select {
+			case event := <-subscriber:
+				data, err := json.Marshal(event)
+				if err != nil {
+					slog.Error("Error serializando evento", "error", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				slog.Info("Suscriptor de eventos desconectado", "remote", r.RemoteAddr)
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
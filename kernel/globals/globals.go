@@ -7,35 +7,41 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"slices"
 	"ssoo-kernel/config"
+	"ssoo-utils/clock"
 	"ssoo-utils/httputils"
+	"ssoo-utils/metrics"
 	"ssoo-utils/pcb"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	NewQueue      []*Process = make([]*Process, 0)
-	NewQueueMutex sync.Mutex
-
-	ReadyQueue      []*Process = make([]*Process, 0)
-	ReadyQueueMutex sync.Mutex
+// Prefijo de las colas de READY de cada CPU cuando cpu_affinity está activo.
+// Las políticas con colas de READY propias las registran al cargarse (ver queues.ReadyRouter).
+const CPUQueuePrefix = "READY_CPU_"
 
-	SuspReadyQueue      []*Process = make([]*Process, 0)
-	SuspReadyQueueMutex sync.Mutex
+// Processes tiene todos los procesos del kernel, una cola por estado más las auxiliares de READY.
+var Processes = newKernelProcessTable()
 
-	SuspBlockedQueue      []*Process = make([]*Process, 0)
-	SuspBlockedQueueMutex sync.Mutex
-
-	ExitQueue      []*Process = make([]*Process, 0)
-	ExitQueueMutex sync.Mutex
+func newKernelProcessTable() *ProcessTable {
+	table := NewProcessTable()
+	for _, state := range []pcb.STATE{pcb.NEW, pcb.READY, pcb.BLOCKED, pcb.EXEC, pcb.SUSP_READY, pcb.SUSP_BLOCKED, pcb.EXIT} {
+		table.AddQueue(state.String(), state)
+	}
+	return table
+}
 
-	BlockedQueue      []*Process = make([]*Process, 0)
-	BlockedQueueMutex sync.Mutex
+func CPUQueue(id string) string { return CPUQueuePrefix + id }
 
-	ExecQueue      []*Process = make([]*Process, 0)
-	ExecQueueMutex sync.Mutex
+func IsCPUConnected(id string) bool {
+	AvCPUmu.Lock()
+	defer AvCPUmu.Unlock()
+	return slices.ContainsFunc(AvailableCPUs, func(cpu *CPUConnection) bool { return cpu.ID == id })
+}
 
+var (
 	AvailableIOs []*IOConnection = make([]*IOConnection, 0)
 	AvIOmu       sync.Mutex
 
@@ -58,9 +64,11 @@ var (
 
 	RetryInitialization = make(chan struct{})
 
-	TotalProcessesCreated int = 0
+	TotalProcessesCreated atomic.Int64 // lo suman CreateProcess y CreateThread, se lee en /metrics y al decidir el apagado
+
+	UnsuspendMutex clock.Mutex // se tiene mientras se hace swap, ver clock.Mutex
 
-	UnsuspendMutex sync.Mutex
+	QuantumMutex sync.Mutex
 
 	// Sending anything to this channel will shutdown the server.
 	// The server will respond back on this same channel to confirm closing.
@@ -68,17 +76,60 @@ var (
 	IOctx, CancelIOctx          = context.WithCancel(context.Background())
 )
 
+// Métricas expuestas en /metrics.
+var (
+	ContextSwitches  = metrics.NewCounter("ssoo_kernel_context_switches_total", "Procesos despachados a una CPU.")
+	Preemptions      = metrics.NewCounter("ssoo_kernel_preemptions_total", "Procesos desalojados por el planificador.")
+	StateTransitions = metrics.NewCounterVec("ssoo_kernel_state_transitions_total", "Transiciones de los procesos por estado destino.", "state")
+	StateSeconds     = metrics.NewCounterVec("ssoo_kernel_state_seconds_total", "Tiempo que pasaron los procesos en cada estado, sumado al salir de él.", "state")
+	Migrations       = metrics.NewCounter("ssoo_kernel_migrations_total", "Despachos de un proceso a una CPU distinta de la última en la que corrió.")
+	Steals           = metrics.NewCounter("ssoo_kernel_steals_total", "Procesos que una CPU ociosa tomó de la cola de otra CPU.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ssoo_kernel_processes_created", "Procesos creados desde el arranque.", func() float64 {
+		return float64(TotalProcessesCreated.Load())
+	})
+	metrics.NewGaugeFunc("ssoo_kernel_cpus_connected", "CPUs conectadas.", func() float64 {
+		AvCPUmu.Lock()
+		defer AvCPUmu.Unlock()
+		return float64(len(AvailableCPUs))
+	})
+	metrics.NewGaugeFunc("ssoo_kernel_cpus_busy", "CPUs con un proceso asignado.", func() float64 {
+		AvCPUmu.Lock()
+		defer AvCPUmu.Unlock()
+		busy := 0
+		for _, cpu := range AvailableCPUs {
+			if cpu.Process != nil {
+				busy++
+			}
+		}
+		return float64(busy)
+	})
+	metrics.NewGaugeVecFunc("ssoo_kernel_io_instances", "Instancias de IO conectadas por dispositivo.", "device", func() map[string]float64 {
+		AvIOmu.Lock()
+		defer AvIOmu.Unlock()
+		instances := make(map[string]float64)
+		for _, io := range AvailableIOs {
+			instances[io.Name]++
+		}
+		return instances
+	})
+}
+
 type IOConnection struct {
 	Name    string
 	IP      string
 	Port    string
 	Handler chan IORequest
 	Disp    bool
+	Served  int // pedidos despachados a la instancia, para repartir la carga (ver devices.Enqueue)
 }
 
 type IORequest struct {
 	Pid   uint
 	Timer int
+	Op    string
 }
 
 type Blocked struct {
@@ -87,6 +138,8 @@ type Blocked struct {
 	Time        int
 	Working     bool
 	DUMP_MEMORY bool          // si se debe hacer DUMP_MEMORY al desbloquear
+	Sleep       bool          // bloqueado por SLEEP, lo despierta un timer del kernel y no una IO
+	Op          string        // operación que mueve datos (filesystem, IO_STDOUT, IO_STDIN), vacío en una IO común
 	CancelTimer chan struct{} // canal para cancelar el timer
 }
 
@@ -98,7 +151,8 @@ type CPUConnection struct {
 }
 
 type CPURequest struct {
-	PID uint `json:"pid"`
+	PID uint `json:"pid"` // PID del proceso en memoria, compartido por todos sus hilos
+	TID uint `json:"tid"`
 	PC  int  `json:"pc"`
 }
 
@@ -111,18 +165,57 @@ type Process struct {
 	EstimatedBurst int64     // estimación actual
 	TimerRunning   bool      // si se ha iniciado el timer en mts
 	InMemory       bool      // si el proceso está en memoria
+
+	Quantum          int64         // quantum asignado en el último despacho (RR/VRR)
+	RemainingQuantum int64         // quantum sin consumir al bloquearse (VRR)
+	QuantumCancel    chan struct{} // canal para cancelar el timer de quantum
+	Level            int           // nivel de MLFQ
+
+	Priority        int          // prioridad asignada al crearse, 0 es la más alta
+	CurrentPriority atomic.Int64 // prioridad efectiva, mejora con aging mientras espera en READY
+
+	Killed atomic.Bool // se pidió finalizarlo desde afuera, se termina en cuanto deja la CPU
+
+	LastCPU    string // ID de la última CPU en la que corrió
+	Migrations int    // veces que se despachó a una CPU distinta de LastCPU
+
+	// Hilos (ver threads.go). Cada hilo secundario es un Process propio con su PCB y su PID de kernel.
+	TID     uint       // 0 es el hilo principal
+	Owner   *Process   // hilo principal del proceso, nil en el principal
+	Threads []*Process // hilos secundarios, solo en el principal
+	Joiners []*Process // hilos bloqueados en THREAD_JOIN esperando a este
+	nextTID uint
+
+	// Árbol de procesos (ver tree.go), solo en el hilo principal.
+	Parent       *Process      // proceso que lo creó con INIT_PROC, nil si lo creó el kernel
+	Children     []*Process    // hijos que siguen vivos
+	ChildWaiters []ChildWaiter // hilos bloqueados en WAIT_CHILD
 }
 
 var ReadySuspended = false
 
-func (p Process) GetPath() string { return config.Values.CodeFolder + "/" + p.Path }
+// BurstFinished se llama cada vez que un proceso deja la CPU.
+// La define la política de corto plazo activa (ver scheduler.LoadPolicies).
+var BurstFinished func(process *Process, reason string) = func(process *Process, reason string) {
+	UpdateBurstEstimation(process)
+}
+
+func (p *Process) GetPath() string { return config.Values.CodeFolder + "/" + p.Path }
 
-func SendIORequest(pid uint, timer int, io *IOConnection) {
-	io.Handler <- IORequest{Pid: pid, Timer: timer}
+// String arma la respuesta que recibe el dispositivo: "pid|tiempo", y "|operación" si el pedido mueve datos.
+func (r IORequest) String() string {
+	if r.Op == "" {
+		return fmt.Sprintf("%d|%d", r.Pid, r.Timer)
+	}
+	return fmt.Sprintf("%d|%d|%s", r.Pid, r.Timer, r.Op)
 }
 
+// BeforeShutdown se llama al cerrar el kernel, antes de apagar el resto de los módulos.
+var BeforeShutdown func() = func() {}
+
 func ClearAndExit() {
 	fmt.Println("Cerrando Kernel...")
+	BeforeShutdown()
 
 	CancelIOctx()
 
@@ -150,7 +243,7 @@ func ClearAndExit() {
 
 func UpdateBurstEstimation(process *Process) {
 
-	realBurst := time.Since(process.StartTime).Milliseconds()
+	realBurst := clock.Since(process.StartTime).Milliseconds()
 	previousEstimate := process.EstimatedBurst
 	alpha := config.Values.Alpha
 
@@ -159,12 +252,6 @@ func UpdateBurstEstimation(process *Process) {
 
 	process.LastRealBurst = realBurst
 	process.EstimatedBurst = newEstimate
-
-	if config.Values.SchedulerAlgorithm == "SJF" || config.Values.SchedulerAlgorithm == "SRT" {
-
-		slog.Info(fmt.Sprintf("PID %d - Burst real: %dms - Estimada previa: %dms - Nueva estimación: %dms",
-			process.PCB.GetPID(), realBurst, previousEstimate, newEstimate))
-	}
 }
 
 func TiempoRestanteDeRafaga(process *Process) int64 {
@@ -172,7 +259,7 @@ func TiempoRestanteDeRafaga(process *Process) int64 {
 	start := process.StartTime
 	estimado := process.EstimatedBurst
 
-	restante := estimado - time.Since(start).Milliseconds() //cuanto le resta
+	restante := estimado - clock.Since(start).Milliseconds() //cuanto le resta
 
 	if restante < 0 {
 		return 0
@@ -218,47 +305,126 @@ func MenorTiempoRestanteDeRafaga(procesos []*Process) *Process {
 	return maxProcess
 }
 
-func UnlockSTS() {
+// StopQuantumTimer cancela el timer de quantum del proceso (si tiene uno)
+// y guarda el quantum que le quedó sin consumir.
+func StopQuantumTimer(process *Process) {
+	QuantumMutex.Lock()
+	defer QuantumMutex.Unlock()
+	if process.QuantumCancel == nil {
+		return
+	}
+	close(process.QuantumCancel)
+	process.QuantumCancel = nil
+
+	restante := process.Quantum - clock.Since(process.StartTime).Milliseconds()
+	if restante < 0 {
+		restante = 0
+	}
+	process.RemainingQuantum = restante
+}
+
+/*
+Los planificadores se despiertan con señales por canal. Cada señal que llega lleva un trabajo del reloj
+(ver clock.Hold) que el planificador suelta recién cuando vuelve a esperar (ver Waiter): así el reloj virtual
+no avanza entre que se manda la señal y el planificador termina su pasada.
+*/
+
+// Signal despierta sin bloquear a quien espera en ch. Devuelve false si nadie esperaba.
+func Signal(ch chan struct{}) bool {
+	clock.Hold()
 	select {
-	case STSEmpty <- struct{}{}:
-		slog.Debug("Desbloqueando STS porque hay procesos en READY")
+	case ch <- struct{}{}:
+		return true
 	default:
+		clock.Release()
+		return false
+	}
+}
+
+// Waiter es el lado de un planificador que espera señales.
+type Waiter struct {
+	held bool
+}
+
+// Wait suelta el trabajo de la señal anterior, si la hubo, y espera la próxima.
+func (w *Waiter) Wait(ch chan struct{}) {
+	if w.held {
+		clock.Release()
+	}
+	<-ch
+	w.held = true
+}
+
+// Close suelta el trabajo de la última señal, para cuando el planificador deja de esperar.
+func (w *Waiter) Close() {
+	if w.held {
+		clock.Release()
+		w.held = false
+	}
+}
+
+func UnlockSTS() {
+	if Signal(STSEmpty) {
+		slog.Debug("Desbloqueando STS porque hay procesos en READY")
+	} else {
 		slog.Debug("STS ya desbloqueado, no se envía señal")
 	}
-	select {
-	case CpuAvailableSignal <- struct{}{}:
+	if Signal(CpuAvailableSignal) {
 		slog.Debug("Desbloqueando STS porque hay procesos en READY")
-	default:
+	} else {
 		slog.Debug("STS ya desbloqueado, no se envía señal")
 	}
 }
 
 func UnlockLTS() {
+	clock.Hold()
 	select {
 	case LTSEmpty <- struct{}{}:
 		slog.Debug("Desbloqueando LTS...")
 	case RetryInitialization <- struct{}{}:
 		slog.Debug("Intentando inicializar proceso bloqueado por falta de memoria...")
 	default:
+		clock.Release()
 	}
 }
 
 func UnlockMTS() {
-	select {
-	case MTSEmpty <- struct{}{}:
+	if Signal(MTSEmpty) {
 		slog.Debug("Desbloqueando MTS...")
-	default:
 	}
 }
 
-// removeBlockedByPID removes a blocked process from globals.MTSQueue by PID.
-func RemoveBlockedByPID(pid uint) {
+// #region MTS QUEUE
+
+func AddBlocked(blocked *Blocked) {
+	MTSQueueMu.Lock()
+	MTSQueue = append(MTSQueue, blocked)
+	MTSQueueMu.Unlock()
+}
+
+// RemoveBlocked saca de MTSQueue el primer bloqueo que cumple match. Nil si no hay ninguno.
+func RemoveBlocked(match func(*Blocked) bool) *Blocked {
+	MTSQueueMu.Lock()
+	defer MTSQueueMu.Unlock()
 	for i, blocked := range MTSQueue {
-		if blocked.Process.PCB.GetPID() == pid {
-			MTSQueueMu.Lock()
-			MTSQueue = append(MTSQueue[:i], MTSQueue[i+1:]...)
-			MTSQueueMu.Unlock()
-			return
+		if match(blocked) {
+			MTSQueue = slices.Delete(MTSQueue, i, i+1)
+			return blocked
 		}
 	}
+	return nil
+}
+
+// RemoveBlockedByPID saca de MTSQueue el bloqueo del proceso pid.
+func RemoveBlockedByPID(pid uint) *Blocked {
+	return RemoveBlocked(func(blocked *Blocked) bool { return blocked.Process.PCB.GetPID() == pid })
 }
+
+// BlockedList devuelve una copia de MTSQueue.
+func BlockedList() []*Blocked {
+	MTSQueueMu.Lock()
+	defer MTSQueueMu.Unlock()
+	return slices.Clone(MTSQueue)
+}
+
+// #endregion
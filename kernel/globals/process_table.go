@@ -0,0 +1,316 @@
+package globals
+
+import (
+	"slices"
+	"ssoo-utils/pcb"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ProcessTable es dueña de todos los procesos del kernel y de las colas en las que están.
+
+Todas las operaciones toman el mismo lock, así que un cambio de estado
+(sacar de una cola, cambiar el estado y encolar en otra) es atómico y ningún proceso
+se pierde ni queda en dos colas a la vez. Un proceso que se saca de su cola sin encolarlo
+en otra (ej. mientras se despacha a una CPU) sigue registrado "en tránsito" hasta que se encola.
+*/
+type ProcessTable struct {
+	mu     sync.Mutex
+	names  []string             // orden en el que se listan las colas
+	states map[string]pcb.STATE // estado de los procesos de cada cola
+	queues map[string][]*Process
+	byPID  map[uint]*Process
+	where  map[uint]string // cola de cada proceso, "" si está en tránsito
+}
+
+// Transition describe un cambio de cola, para loguearlo fuera del lock.
+type Transition struct {
+	Process *Process
+	From    pcb.STATE
+	To      pcb.STATE
+	Queue   string
+	PIDs    []uint        // PIDs de la cola destino después de encolar
+	Spent   time.Duration // tiempo que el proceso estuvo en From
+}
+
+type NamedQueue struct {
+	Name      string
+	State     pcb.STATE
+	Processes []*Process
+}
+
+func NewProcessTable() *ProcessTable {
+	return &ProcessTable{
+		states: make(map[string]pcb.STATE),
+		queues: make(map[string][]*Process),
+		byPID:  make(map[uint]*Process),
+		where:  make(map[uint]string),
+	}
+}
+
+// AddQueue registra una cola para los procesos en state. Registrar dos veces la misma no hace nada.
+func (t *ProcessTable) AddQueue(name string, state pcb.STATE) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.states[name]; exists {
+		return
+	}
+	t.names = append(t.names, name)
+	t.states[name] = state
+	t.queues[name] = make([]*Process, 0)
+}
+
+func (t *ProcessTable) queueOf(name string) []*Process {
+	queue, exists := t.queues[name]
+	if !exists {
+		panic("una persona con pocas neuronas puso una cola inválida, encuentrenla y mátenla: " + name)
+	}
+	return queue
+}
+
+// detach saca al proceso de su cola actual, si está en alguna. Requiere el lock tomado.
+func (t *ProcessTable) detach(process *Process) {
+	pid := process.PCB.GetPID()
+	name := t.where[pid]
+	if name == "" {
+		return
+	}
+	queue := t.queues[name]
+	if index := slices.Index(queue, process); index >= 0 {
+		t.queues[name] = slices.Delete(queue, index, index+1)
+	}
+	t.where[pid] = ""
+}
+
+// move pasa al proceso a la cola name y actualiza su estado. Requiere el lock tomado.
+func (t *ProcessTable) move(process *Process, name string) Transition {
+	queue := t.queueOf(name)
+	pid := process.PCB.GetPID()
+
+	t.detach(process)
+	from := process.PCB.GetState()
+	entered := process.PCB.StateSince()
+	process.PCB.SetState(t.states[name])
+	spent := process.PCB.StateSince().Sub(entered)
+
+	t.queues[name] = append(queue, process)
+	t.byPID[pid] = process
+	t.where[pid] = name
+
+	pids := make([]uint, 0, len(t.queues[name]))
+	for _, p := range t.queues[name] {
+		pids = append(pids, p.PCB.GetPID())
+	}
+	return Transition{Process: process, From: from, To: t.states[name], Queue: name, PIDs: pids, Spent: spent}
+}
+
+// Move encola al proceso en name, sacándolo de la cola en la que esté.
+func (t *ProcessTable) Move(process *Process, name string) Transition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.move(process, name)
+}
+
+// MoveIf mueve al proceso pid a la cola que elige route solo si está en el estado from.
+// Devuelve false si el proceso no existe o ya cambió de estado.
+func (t *ProcessTable) MoveIf(pid uint, from pcb.STATE, route func(*Process) string) (Transition, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	process, ok := t.byPID[pid]
+	if !ok || process.PCB.GetState() != from {
+		return Transition{}, false
+	}
+	return t.move(process, route(process)), true
+}
+
+// Peek devuelve el proceso que elige pick en la cola name, sin sacarlo. Nil si está vacía.
+func (t *ProcessTable) Peek(name string, pick func([]*Process) *Process) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	queue := t.queueOf(name)
+	if len(queue) == 0 {
+		return nil
+	}
+	return pick(queue)
+}
+
+// PeekState devuelve el proceso que elige pick entre todas las colas del estado state, sin sacarlo.
+func (t *ProcessTable) PeekState(state pcb.STATE, pick func([]*Process) *Process) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make([]*Process, 0)
+	for _, name := range t.names {
+		if t.states[name] == state {
+			all = append(all, t.queues[name]...)
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return pick(all)
+}
+
+// Take saca de la cola name al proceso que elige pick. Nil si está vacía.
+func (t *ProcessTable) Take(name string, pick func([]*Process) *Process) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	queue := t.queueOf(name)
+	if len(queue) == 0 {
+		return nil
+	}
+	process := pick(queue)
+	if process == nil {
+		return nil
+	}
+	t.detach(process)
+	return process
+}
+
+// TakeLongest saca con pick un proceso de la cola más larga cuyo nombre empieza con prefix,
+// ignorando la cola exclude. Nil si están todas vacías.
+func (t *ProcessTable) TakeLongest(prefix string, exclude string, pick func([]*Process) *Process) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	longest := ""
+	for _, name := range t.names {
+		if name == exclude || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if len(t.queues[name]) > 0 && (longest == "" || len(t.queues[name]) > len(t.queues[longest])) {
+			longest = name
+		}
+	}
+	if longest == "" {
+		return nil
+	}
+	process := pick(t.queues[longest])
+	if process == nil {
+		return nil
+	}
+	t.detach(process)
+	return process
+}
+
+// TakeByPID saca de su cola al proceso pid si está en el estado state.
+func (t *ProcessTable) TakeByPID(state pcb.STATE, pid uint) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	process, ok := t.byPID[pid]
+	if !ok || t.where[pid] == "" || process.PCB.GetState() != state {
+		return nil
+	}
+	t.detach(process)
+	return process
+}
+
+// Find busca al proceso pid entre las colas del estado state.
+func (t *ProcessTable) Find(state pcb.STATE, pid uint) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	process, ok := t.byPID[pid]
+	if !ok || t.where[pid] == "" || process.PCB.GetState() != state {
+		return nil
+	}
+	return process
+}
+
+// Get devuelve al proceso pid en cualquier estado, incluso en tránsito.
+func (t *ProcessTable) Get(pid uint) *Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.byPID[pid]
+}
+
+// Len cuenta los procesos encolados en las colas del estado state.
+func (t *ProcessTable) Len(state pcb.STATE) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := 0
+	for name, queue := range t.queues {
+		if t.states[name] == state {
+			total += len(queue)
+		}
+	}
+	return total
+}
+
+// List devuelve una copia de la cola name.
+func (t *ProcessTable) List(name string) []*Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.queueOf(name))
+}
+
+// Queues devuelve una copia de todas las colas en el orden en que se registraron.
+func (t *ProcessTable) Queues() []NamedQueue {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := make([]NamedQueue, 0, len(t.names))
+	for _, name := range t.names {
+		snapshot = append(snapshot, NamedQueue{name, t.states[name], slices.Clone(t.queues[name])})
+	}
+	return snapshot
+}
+
+// All devuelve todos los procesos registrados, incluidos los que están en tránsito.
+func (t *ProcessTable) All() []*Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make([]*Process, 0, len(t.byPID))
+	for _, process := range t.byPID {
+		all = append(all, process)
+	}
+	return all
+}
+
+// Update ejecuta fn sobre la cola name con el lock tomado, fn no debe cambiar el largo de la cola.
+func (t *ProcessTable) Update(name string, fn func(queue []*Process)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(t.queueOf(name))
+}
+
+// UpdateState ejecuta fn sobre cada cola del estado state, con las mismas reglas que Update.
+func (t *ProcessTable) UpdateState(state pcb.STATE, fn func(queue []*Process)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, name := range t.names {
+		if t.states[name] == state {
+			fn(t.queues[name])
+		}
+	}
+}
+
+// Splice mueve todos los procesos de la cola from al final de la cola to (mismo estado).
+func (t *ProcessTable) Splice(from string, to string, fn func(*Process)) []*Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	moved := t.queueOf(from)
+	for _, process := range moved {
+		fn(process)
+		t.where[process.PCB.GetPID()] = to
+	}
+	t.queues[to] = append(t.queueOf(to), moved...)
+	t.queues[from] = make([]*Process, 0)
+	return moved
+}
+
+// Trim descarta de la tabla los procesos más viejos de la cola name dejando los últimos keep.
+func (t *ProcessTable) Trim(name string, keep int) []*Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	queue := t.queueOf(name)
+	excess := len(queue) - keep
+	if excess <= 0 {
+		return nil
+	}
+	trimmed := slices.Clone(queue[:excess])
+	for _, process := range trimmed {
+		delete(t.byPID, process.PCB.GetPID())
+		delete(t.where, process.PCB.GetPID())
+	}
+	t.queues[name] = slices.Delete(queue, 0, excess)
+	return trimmed
+}
@@ -0,0 +1,119 @@
+package globals
+
+import (
+	"math/rand/v2"
+	"ssoo-utils/pcb"
+	"sync"
+	"testing"
+)
+
+/*
+Estrés de la ProcessTable, pensado para correr con go test -race.
+
+Varias goroutines hacen a la vez lo que hacen los handlers del kernel con un proceso:
+despacharlo (READY → EXEC), bloquearlo por una syscall (EXEC → BLOCKED), terminar su IO
+(BLOCKED → READY o SUSP_BLOCKED → SUSP_READY), suspenderlo (BLOCKED → SUSP_BLOCKED) y
+desuspenderlo (SUSP_READY → READY), y marcarlo para finalizar desde la admin API mientras corre.
+Al final cada proceso tiene que estar en exactamente una cola, la de su estado, sin perderse ni duplicarse.
+*/
+func TestProcessTableConcurrentTransitions(t *testing.T) {
+	const (
+		processes  = 64
+		workers    = 16
+		iterations = 5000
+	)
+
+	table := NewProcessTable()
+	names := map[pcb.STATE]string{
+		pcb.READY:        "READY",
+		pcb.EXEC:         "EXEC",
+		pcb.BLOCKED:      "BLOCKED",
+		pcb.SUSP_BLOCKED: "SUSP_BLOCKED",
+		pcb.SUSP_READY:   "SUSP_READY",
+	}
+	for state, name := range names {
+		table.AddQueue(name, state)
+	}
+	for pid := range uint(processes) {
+		table.Move(&Process{PCB: pcb.Create(pid, "stress")}, "READY")
+	}
+
+	first := func(queue []*Process) *Process { return queue[0] }
+	to := func(name string) func(*Process) string { return func(*Process) string { return name } }
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				pid := rand.UintN(processes)
+				switch rand.IntN(7) {
+				case 0: // STS despacha
+					if process := table.Take("READY", first); process != nil {
+						table.Move(process, "EXEC")
+					}
+				case 1: // syscall bloqueante, se ignora si se pidió finalizar al proceso
+					if process := table.TakeByPID(pcb.EXEC, pid); process != nil {
+						if process.Killed.Load() {
+							table.Move(process, "EXEC")
+						} else {
+							table.Move(process, "BLOCKED")
+						}
+					}
+				case 2: // fin de IO, con o sin suspensión
+					if _, ok := table.MoveIf(pid, pcb.BLOCKED, to("READY")); !ok {
+						table.MoveIf(pid, pcb.SUSP_BLOCKED, to("SUSP_READY"))
+					}
+				case 3: // timer de suspensión
+					table.MoveIf(pid, pcb.BLOCKED, to("SUSP_BLOCKED"))
+				case 4: // MTS desuspende
+					if process := table.Take("SUSP_READY", first); process != nil {
+						table.Move(process, "READY")
+					}
+				case 5: // admin API leyendo las colas
+					checkNoDuplicates(t, table)
+				case 6: // admin API finalizando un proceso
+					if process := table.Get(pid); process != nil {
+						process.Killed.Store(rand.IntN(2) == 0)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint]string)
+	for _, queue := range table.Queues() {
+		for _, process := range queue.Processes {
+			pid := process.PCB.GetPID()
+			if previous, exists := seen[pid]; exists {
+				t.Errorf("proceso %d en %s y en %s", pid, previous, queue.Name)
+			}
+			seen[pid] = queue.Name
+			if process.PCB.GetState() != queue.State {
+				t.Errorf("proceso %d en %s con estado %s", pid, queue.Name, process.PCB.GetState())
+			}
+			if table.Get(pid) != process {
+				t.Errorf("proceso %d no coincide con el registrado en la tabla", pid)
+			}
+		}
+	}
+	if len(seen) != processes {
+		t.Errorf("hay %d procesos encolados, se esperaban %d", len(seen), processes)
+	}
+}
+
+// checkNoDuplicates verifica que una foto de las colas no tenga un proceso en dos lugares.
+// Puede faltar alguno, los que están en tránsito entre Take y Move.
+func checkNoDuplicates(t *testing.T, table *ProcessTable) {
+	seen := make(map[uint]bool)
+	for _, queue := range table.Queues() {
+		for _, process := range queue.Processes {
+			if seen[process.PCB.GetPID()] {
+				t.Errorf("proceso %d en dos colas a la vez", process.PCB.GetPID())
+			}
+			seen[process.PCB.GetPID()] = true
+		}
+	}
+}
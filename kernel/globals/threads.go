@@ -0,0 +1,76 @@
+package globals
+
+import (
+	"slices"
+	"ssoo-utils/pcb"
+	"sync"
+)
+
+/*
+Hilos de un proceso.
+
+Un proceso arranca con su hilo principal (TID 0), que es el Process que creó INIT_PROC.
+THREAD_CREATE agrega hilos secundarios: cada uno es un Process con su propio PCB, PC y estado,
+que el STS planifica como a cualquier otro. En Memoria todos usan el PID del principal
+(ver MemoryPID), así comparten páginas; el PID de su PCB solo lo conoce el kernel y la IO.
+*/
+
+// ThreadsMutex protege Threads, Joiners y nextTID de todos los procesos.
+var ThreadsMutex sync.Mutex
+
+// Main devuelve el hilo principal del proceso al que pertenece el hilo.
+func (p *Process) Main() *Process {
+	if p.Owner != nil {
+		return p.Owner
+	}
+	return p
+}
+
+// MemoryPID es el PID con el que Memoria y la CPU conocen al proceso del hilo.
+func (p *Process) MemoryPID() uint {
+	return p.Main().PCB.GetPID()
+}
+
+func (p *Process) IsThread() bool {
+	return p.Owner != nil
+}
+
+// AddThread registra thread como hilo secundario de owner y le asigna el próximo TID.
+func AddThread(owner *Process, thread *Process) {
+	ThreadsMutex.Lock()
+	defer ThreadsMutex.Unlock()
+	owner = owner.Main()
+	owner.nextTID++
+	thread.TID = owner.nextTID
+	thread.Owner = owner
+	owner.Threads = append(owner.Threads, thread)
+}
+
+// Thread devuelve el hilo tid del proceso, nil si no existe.
+func (p *Process) Thread(tid uint) *Process {
+	main := p.Main()
+	if tid == 0 {
+		return main
+	}
+	ThreadsMutex.Lock()
+	defer ThreadsMutex.Unlock()
+	index := slices.IndexFunc(main.Threads, func(thread *Process) bool { return thread.TID == tid })
+	if index < 0 {
+		return nil
+	}
+	return main.Threads[index]
+}
+
+// LiveThreads devuelve los hilos del proceso (incluido el principal) que no están en EXIT.
+func (p *Process) LiveThreads() []*Process {
+	main := p.Main()
+	ThreadsMutex.Lock()
+	defer ThreadsMutex.Unlock()
+	live := make([]*Process, 0, len(main.Threads)+1)
+	for _, thread := range append([]*Process{main}, main.Threads...) {
+		if thread.PCB.GetState() != pcb.EXIT {
+			live = append(live, thread)
+		}
+	}
+	return live
+}
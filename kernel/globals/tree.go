@@ -0,0 +1,37 @@
+package globals
+
+import "sync"
+
+/*
+Árbol de procesos.
+
+INIT_PROC crea un hijo del proceso que lo ejecuta. Cuando un proceso termina (su último hilo),
+sus hijos quedan huérfanos y se aplica orphan_policy: "REPARENT" los pasa al abuelo
+(o a la raíz si no tiene) y "CASCADE" finaliza todo el subárbol.
+*/
+
+const (
+	OrphanReparent = "REPARENT"
+	OrphanCascade  = "CASCADE"
+)
+
+// TreeMutex protege Parent, Children y ChildWaiters de todos los procesos.
+var TreeMutex sync.Mutex
+
+// ChildWaiter es un hilo bloqueado en WAIT_CHILD. Any espera a cualquier hijo, si no al hijo PID.
+type ChildWaiter struct {
+	Thread *Process
+	PID    uint
+	Any    bool
+}
+
+// ParentPID devuelve el PID del padre, nil si no tiene.
+func (p *Process) ParentPID() *uint {
+	TreeMutex.Lock()
+	defer TreeMutex.Unlock()
+	if p.Main().Parent == nil {
+		return nil
+	}
+	pid := p.Main().Parent.PCB.GetPID()
+	return &pid
+}
@@ -13,12 +13,19 @@ import (
 	"slices"
 	kernel_api "ssoo-kernel/api"
 	"ssoo-kernel/config"
+	"ssoo-kernel/devices"
+	"ssoo-kernel/events"
 	globals "ssoo-kernel/globals"
+	"ssoo-kernel/messages"
 	"ssoo-kernel/queues"
+	"ssoo-kernel/resources"
 	scheduler "ssoo-kernel/scheduler"
 	"ssoo-kernel/shared"
+	"ssoo-kernel/timeline"
+	"ssoo-utils/clock"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"ssoo-utils/parsers"
 	"ssoo-utils/pcb"
 	"strconv"
@@ -36,6 +43,31 @@ func main() {
 	config.Load()
 
 	fmt.Printf("Config Loaded:\n%s", parsers.Struct(config.Values))
+
+	if err := resources.Init(); err != nil {
+		fmt.Printf("Error en la configuración de recursos: %v\n", err)
+		return
+	}
+
+	if err := messages.Init(); err != nil {
+		fmt.Printf("Error en la configuración de colas de mensajes: %v\n", err)
+		return
+	}
+
+	if err := shared.ValidateOrphanPolicy(); err != nil {
+		fmt.Printf("Error en la configuración del árbol de procesos: %v\n", err)
+		return
+	}
+
+	if err := scheduler.LoadPolicies(); err != nil {
+		fmt.Printf("Error en la configuración de planificación: %v\n", err)
+		return
+	}
+
+	if err := devices.Init(); err != nil {
+		fmt.Printf("Error en la configuración de dispositivos: %v\n", err)
+		return
+	}
 	err := logger.SetupDefault("kernel", config.Values.LogLevel)
 	defer logger.Close()
 	if err != nil {
@@ -45,11 +77,29 @@ func main() {
 	log := logger.Instance
 	log.Info("Arranca Kernel")
 
+	if err := clock.Setup(config.Values.ClockMode, ""); err != nil {
+		fmt.Printf("Error configurando el reloj: %v\n", err)
+		return
+	}
+
+	resources.Terminate = kernel_api.Kill
+	shared.Terminate = kernel_api.Kill
+	messages.Terminate = kernel_api.Kill
+
+	if config.Values.TimelineFolder != "" {
+		globals.BeforeShutdown = func() {
+			if err := timeline.Save(config.Values.TimelineFolder, queues.All()); err != nil {
+				slog.Error("No se pudo guardar la línea de tiempo", "error", err)
+			}
+		}
+	}
+
 	var initialProcessFilename string
 	var initialProcessSize int
+	var initialProcessPriority int
 	if len(os.Args) > 1 {
 		if len(os.Args) < 3 {
-			fmt.Println("Faltan argumentos! Uso: ./kernel [archivo_pseudocodigo] [tamanio_proceso] [...args]")
+			fmt.Println("Faltan argumentos! Uso: ./kernel [archivo_pseudocodigo] [tamanio_proceso] [prioridad] [...args]")
 			return
 		}
 		AbsolutepathFile := config.Values.CodeFolder + "/" + os.Args[1]
@@ -67,7 +117,17 @@ func main() {
 			fmt.Printf("Error al convertir el tamaño del proceso '%s' a entero: %v\n", processSizeStr, err)
 			return
 		}
-	} else {
+
+		if len(os.Args) > 3 {
+			processPriorityStr := os.Args[3]
+			initialProcessPriority, err = strconv.Atoi(processPriorityStr)
+
+			if err != nil || initialProcessPriority < 0 {
+				fmt.Printf("Prioridad del proceso '%s' inválida: %v\n", processPriorityStr, err)
+				return
+			}
+		}
+	} else if !config.Values.Daemon {
 		slog.Info("Activando funcionamiento por defecto.")
 		initialProcessFilename = "helloworld"
 		initialProcessSize = 1024
@@ -81,15 +141,38 @@ func main() {
 	// Add routes to mux
 
 	// Pass the globalCloser to handlers that will block.
-	mux.Handle("/cpu-notify", kernel_api.ReceiveCPU())
+	mux.Handle("/cpu-notify", clock.Holding(kernel_api.ReceiveCPU()))
 	mux.Handle("/io-notify", recieveIO(globals.IOctx))
 	mux.Handle("/io-finished", handleIOFinished())
-	mux.Handle("/io-disconnected", handleIODisconnected())
+	mux.Handle("/io-disconnected", clock.Holding(handleIODisconnected()))
 	mux.Handle("/cpu-results", kernel_api.ReceivePidPcReason())
 	mux.Handle("/syscall", kernel_api.RecieveSyscall())
+	mux.Handle("/processes", kernel_api.ListProcesses())
+	mux.Handle("/processes/{pid}", kernel_api.GetProcess())
+	mux.Handle("/processes/tree", kernel_api.ProcessTree())
+	mux.Handle("/queues", kernel_api.ListQueues())
+	mux.Handle("/cpus", kernel_api.ListCPUs())
+	mux.Handle("/ios", kernel_api.ListIOs())
+	mux.Handle("/process", clock.Holding(kernel_api.HandleProcess()))
+	mux.Handle("/timeline", kernel_api.Timeline())
+	mux.Handle("/timeline/chart", kernel_api.Timeline())
+	mux.Handle("/deadlocks", kernel_api.Deadlocks())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/events", events.Handler(globals.IOctx))
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		go func() {
+			fmt.Println("Se solició cierre. o7")
+			queues.MostrarLasColas("Finalizacion de Kernel")
+			globals.ClearAndExit()
+		}()
+	})
 	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	if virtual, ok := clock.Current().(*clock.Virtual); ok {
+		mux.Handle("/clock/", clock.Handler(virtual))
+	}
 
 	httputils.StartHTTPServer(httputils.GetOutboundIP(), config.Values.PortKernel, mux, globals.ShutdownSignal)
 
@@ -121,15 +204,22 @@ func main() {
 		globals.ClearAndExit()
 	}()
 
-	shared.CreateProcess(initialProcessFilename, initialProcessSize)
+	if initialProcessFilename != "" {
+		shared.CreateProcess(nil, initialProcessFilename, initialProcessSize, initialProcessPriority)
+	} else {
+		slog.Info("Modo daemon sin proceso inicial, se esperan procesos por POST /process")
+	}
 
 	go scheduler.LTS()
 	go scheduler.STS()
 	go scheduler.MTS()
+	scheduler.RunPolicyTasks()
+	go resources.RunDetector()
 
 	fmt.Print("\nPresione enter para iniciar el planificador de largo plazo...\n\n")
 	bufio.NewReader(os.Stdin).ReadString('\n')
 
+	clock.Hold() // lo suelta el LTS, ver globals.Waiter
 	globals.LTSStopped <- struct{}{}
 
 	select {}
@@ -185,29 +275,23 @@ func recieveIO(ctx context.Context) http.HandlerFunc {
 			globals.AvIOmu.Lock()
 			globals.AvailableIOs = append(globals.AvailableIOs, ioConnection)
 			globals.AvIOmu.Unlock()
+			events.Device(events.IOConnected, "registered", fmt.Sprintf("%s %s:%s", name, ip, port))
 		}
 
-		// check if there is a process waiting for this IO
-
-		for _, blocked := range globals.MTSQueue {
-			if blocked.Name == name && !blocked.Working {
-				ioConnection.Disp = false
-				blocked.Working = true
-				slog.Info("Found waiting process for IO", "pid", blocked.Process.PCB.GetPID(), "ioName", name)
-
-				w.WriteHeader(http.StatusOK)
-				w.Header().Set("Content-Type", "text/plain")
-				w.Write([]byte(fmt.Sprintf("%d|%d", blocked.Process.PCB.GetPID(), blocked.Time)))
-
-				return
-			}
+		// Si hay pedidos en la cola del dispositivo se atiende el que elige su política,
+		// si no la instancia queda libre esperando el próximo.
+		if request, ok := devices.Next(ioConnection); ok {
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(request.String()))
+			return
 		}
 
 		select {
 		case request := <-ioConnection.Handler:
 			w.WriteHeader(http.StatusOK)
 			w.Header().Set("Content-Type", "text/plain")
-			w.Write([]byte(fmt.Sprintf("%d|%d", request.Pid, request.Timer)))
+			w.Write([]byte(request.String()))
 		case <-ctx.Done():
 			w.WriteHeader(http.StatusTeapot)
 		}
@@ -219,7 +303,7 @@ func CreateIOConnection(name string, ip string, port string) *globals.IOConnecti
 	ioConnection.Name = name
 	ioConnection.IP = ip
 	ioConnection.Port = port
-	ioConnection.Handler = make(chan globals.IORequest)
+	ioConnection.Handler = make(chan globals.IORequest, 1)
 	ioConnection.Disp = true
 	return ioConnection
 }
@@ -277,37 +361,45 @@ func handleIOFinished() http.HandlerFunc {
 		}
 
 		slog.Info("Handling IO finished", "name", name, "pid", pid, " ip", ip, "port", port)
-		logger.RequiredLog(true, uint(pid),
-			fmt.Sprintf("## (%d) finalizó IO y pasa a READY", pid), nil)
-
-		var process *globals.Process
 
 		globals.UnsuspendMutex.Lock()
-		defer globals.UnsuspendMutex.Unlock()
-		for i, blocked := range globals.MTSQueue {
-			if blocked.Name == name && blocked.Process.PCB.GetPID() == uint(pid) {
-				process = blocked.Process
+		blocked := globals.RemoveBlocked(func(blocked *globals.Blocked) bool {
+			return blocked.Name == name && blocked.Process.PCB.GetPID() == uint(pid)
+		})
 
-				globals.MTSQueueMu.Lock()
-				globals.MTSQueue = append(globals.MTSQueue[:i], globals.MTSQueue[i+1:]...)
-				globals.MTSQueueMu.Unlock()
-			}
-		}
-
-		if process == nil {
+		if blocked == nil {
+			globals.UnsuspendMutex.Unlock()
 			slog.Error("No se encontró el proceso en MTSQueue para IO finished", "name", name, "pid", pid)
 			http.Error(w, "Process not found for IO finished", http.StatusNotFound)
 			return
 		}
 
-		if process.PCB.GetState() == pcb.SUSP_BLOCKED {
-			queues.RemoveByPID(pcb.SUSP_BLOCKED, process.PCB.GetPID())
-			queues.Enqueue(pcb.SUSP_READY, process)
-			globals.UnlockMTS()
-		} else if process.PCB.GetState() == pcb.BLOCKED {
-			queues.RemoveByPID(pcb.BLOCKED, process.PCB.GetPID())
-			queues.Enqueue(pcb.READY, process)
+		// Un pedido que mueve datos y falló finaliza al proceso. Esos pedidos no se suspenden, el proceso sigue en BLOCKED.
+		if failure := query.Get("error"); failure != "" {
+			process := queues.Move(pcb.BLOCKED, pcb.EXIT, uint(pid))
+			globals.UnsuspendMutex.Unlock()
+			logger.RequiredLog(true, uint(pid), "Falló la operación del dispositivo, se finaliza el proceso", map[string]string{
+				"Operación": blocked.Op,
+				"Error":     failure,
+			})
+			if process != nil {
+				shared.TerminateProcess(process)
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(fmt.Sprintf("IO failed for PID %d", pid)))
+			return
+		}
+		defer globals.UnsuspendMutex.Unlock()
+
+		logger.RequiredLog(true, uint(pid),
+			fmt.Sprintf("## (%d) finalizó IO y pasa a READY", pid), nil)
+
+		// El movimiento es condicional: si el timer de suspensión ya lo pasó a SUSP_BLOCKED
+		// el primer Move no hace nada y lo toma el segundo.
+		if queues.Move(pcb.BLOCKED, pcb.READY, uint(pid)) != nil {
 			globals.UnlockSTS()
+		} else if queues.Move(pcb.SUSP_BLOCKED, pcb.SUSP_READY, uint(pid)) != nil {
+			globals.UnlockMTS()
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -360,23 +452,27 @@ func handleIODisconnected() http.HandlerFunc {
 			return
 		}
 
-		for _, blocked := range globals.MTSQueue {
-			if blocked.Name == name && blocked.Process.PCB.GetPID() == uint(pid) {
-
-				process := blocked.Process
-				globals.RemoveBlockedByPID(blocked.Process.PCB.GetPID())
-				queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
-				queues.Enqueue(pcb.EXIT, process)
-				shared.TerminateProcess(process)
-				slog.Info(fmt.Sprintf("Removed process %d from MTS queue due to IO disconnection", process.PCB.GetPID()))
-				break
-			}
+		if blocked := globals.RemoveBlocked(func(blocked *globals.Blocked) bool {
+			return blocked.Name == name && blocked.Process.PCB.GetPID() == uint(pid)
+		}); blocked != nil {
+			killBlocked(blocked)
+			slog.Info(fmt.Sprintf("Removed process %d from MTS queue due to IO disconnection", pid))
 		}
 
+		devices.Disconnect(ioConnection)
+		select {
+		case request := <-ioConnection.Handler:
+			// Pedido despachado que la instancia nunca leyó: vuelve a la cola para otra instancia
+			// y se suelta el trabajo de su despacho, que nadie más va a soltar (ver devices.dispatch).
+			devices.Requeue(ioConnection, request)
+			clock.Release()
+		default:
+		}
 		indexDisconnected := slices.Index(globals.AvailableIOs, ioConnection)
 		globals.AvIOmu.Lock()
 		globals.AvailableIOs = append(globals.AvailableIOs[:indexDisconnected], globals.AvailableIOs[indexDisconnected+1:]...)
 		globals.AvIOmu.Unlock()
+		events.Device(events.IODisconnected, "disconnected", fmt.Sprintf("%s %s:%s", name, ip, port))
 
 		found := false
 
@@ -393,36 +489,23 @@ func handleIODisconnected() http.HandlerFunc {
 			return
 		}
 
+		clock.Hold()
 		go func() {
-			indexesToKill := make([]int, 0)
-			for index, blocked := range globals.MTSQueue {
-				if blocked.Name == ioConnection.Name {
-					indexesToKill = append(indexesToKill, index)
+			defer clock.Release()
+			for {
+				blocked := globals.RemoveBlocked(func(blocked *globals.Blocked) bool { return blocked.Name == ioConnection.Name })
+				if blocked == nil {
 					break
 				}
+				killBlocked(blocked)
+				slog.Info(fmt.Sprintf("Removed process %d from MTS queue due to IO disconnection", blocked.Process.PCB.GetPID()))
 			}
 
-			for _, index := range indexesToKill {
-				process := globals.MTSQueue[index].Process
-
-				globals.MTSQueueMu.Lock()
-				globals.MTSQueue = append(globals.MTSQueue[:index], globals.MTSQueue[index+1:]...)
-				globals.MTSQueueMu.Unlock()
-
-				queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
-				queues.Enqueue(pcb.EXIT, process)
-				shared.TerminateProcess(process)
-				slog.Info(fmt.Sprintf("Removed process %d from MTS queue due to IO disconnection", process.PCB.GetPID()))
-			}
-
-			for index,_ := range globals.SuspReadyQueue {
-				process := globals.SuspReadyQueue[index]
-
-				globals.MTSQueueMu.Lock()
-				globals.SuspReadyQueue = append(globals.SuspReadyQueue[:index], globals.SuspReadyQueue[index+1:]...)
-				globals.MTSQueueMu.Unlock()
-
-				queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
+			for {
+				process := queues.Dequeue(pcb.SUSP_READY, func(queue []*globals.Process) *globals.Process { return queue[0] })
+				if process == nil {
+					break
+				}
 				queues.Enqueue(pcb.EXIT, process)
 				shared.TerminateProcess(process)
 				slog.Info(fmt.Sprintf("Removed process %d from Suspend Ready queue due to IO disconnection", process.PCB.GetPID()))
@@ -436,4 +519,14 @@ func handleIODisconnected() http.HandlerFunc {
 	}
 }
 
+// killBlocked manda a EXIT a un proceso que esperaba un dispositivo que se desconectó.
+func killBlocked(blocked *globals.Blocked) {
+	process := blocked.Process
+	if queues.Move(pcb.BLOCKED, pcb.EXIT, process.PCB.GetPID()) == nil &&
+		queues.Move(pcb.SUSP_BLOCKED, pcb.EXIT, process.PCB.GetPID()) == nil {
+		return
+	}
+	shared.TerminateProcess(process)
+}
+
 // #endregion
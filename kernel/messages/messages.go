@@ -0,0 +1,208 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/memoryutils"
+	"sync"
+)
+
+/*
+Colas de mensajes del kernel para las syscalls MSG_SEND y MSG_RECV.
+
+Cada cola se declara en "message_queues" de kernel_config.json con su capacidad en mensajes
+(0 es una cita: el emisor espera a que un receptor tome el mensaje).
+El kernel lee el mensaje de la memoria del emisor y lo escribe en la del receptor a través de Memoria.
+*/
+
+var ErrUnknownQueue = errors.New("cola de mensajes inexistente")
+
+// Terminate finaliza a un receptor al que no se le pudo entregar el mensaje. Se define en main (ver kernel_api.Kill).
+var Terminate func(process *globals.Process) error = func(process *globals.Process) error {
+	return fmt.Errorf("no hay forma de finalizar procesos")
+}
+
+type receiver struct {
+	process *globals.Process
+	address int
+	size    int
+}
+
+type sender struct {
+	process *globals.Process
+	payload []byte
+}
+
+type Queue struct {
+	Name      string
+	Capacity  int
+	Messages  [][]byte
+	receivers []receiver // bloqueados en MSG_RECV, en orden de llegada
+	senders   []sender   // bloqueados en MSG_SEND con la cola llena, en orden de llegada
+}
+
+var (
+	mu    sync.Mutex
+	table = make(map[string]*Queue)
+)
+
+// Init declara las colas de la configuración con su capacidad.
+func Init() error {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, capacity := range config.Values.MessageQueues {
+		if capacity < 0 {
+			return fmt.Errorf("message_queues: %s tiene una capacidad negativa", name)
+		}
+		table[name] = &Queue{Name: name, Capacity: capacity, Messages: make([][]byte, 0)}
+	}
+	return nil
+}
+
+/*
+Send manda a la cola name los size bytes de la memoria del proceso desde address.
+
+Si hay un receptor esperando se le escribe el mensaje y se lo devuelve para desbloquearlo.
+Si la cola está llena el proceso espera en ella y se llama a block antes de soltar el lock,
+así un MSG_RECV concurrente siempre lo encuentra ya en BLOCKED.
+*/
+func Send(process *globals.Process, name string, address int, size int, block func()) (blocked bool, woken *globals.Process, err error) {
+	mu.Lock()
+	_, exists := table[name]
+	mu.Unlock()
+	if !exists {
+		return false, nil, ErrUnknownQueue
+	}
+
+	payload, err := memory().Read(process.MemoryPID(), address, size)
+	if err != nil {
+		return false, nil, err
+	}
+
+	mu.Lock()
+	queue := table[name]
+	woken, failed := queue.deliver(payload)
+	switch {
+	case woken != nil:
+	case len(queue.Messages) < queue.Capacity:
+		queue.Messages = append(queue.Messages, payload)
+		slog.Debug("MSG_SEND - Mensaje encolado", "pid", process.PCB.GetPID(), "cola", name, "mensajes", len(queue.Messages))
+	default:
+		queue.senders = append(queue.senders, sender{process, payload})
+		slog.Debug("MSG_SEND - Cola llena, se bloquea", "pid", process.PCB.GetPID(), "cola", name)
+		block()
+		blocked = true
+	}
+	mu.Unlock()
+
+	terminate(failed)
+	return blocked, woken, nil
+}
+
+/*
+Receive toma el próximo mensaje de la cola name y lo escribe en la memoria del proceso desde address
+(hasta size bytes, el resto del rango queda en cero).
+
+Si la cola está vacía el proceso espera en ella y se llama a block antes de soltar el lock.
+Si tomar el mensaje libera lugar para un emisor bloqueado, se lo devuelve para desbloquearlo.
+*/
+func Receive(process *globals.Process, name string, address int, size int, block func()) (blocked bool, woken *globals.Process, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	queue, exists := table[name]
+	if !exists {
+		return false, nil, ErrUnknownQueue
+	}
+
+	var payload []byte
+	direct := false
+	switch {
+	case len(queue.Messages) > 0:
+		payload = queue.Messages[0]
+	case len(queue.senders) > 0:
+		// Cola sin capacidad: el mensaje pasa directo del emisor al receptor.
+		payload = queue.senders[0].payload
+		direct = true
+	default:
+		queue.receivers = append(queue.receivers, receiver{process, address, size})
+		slog.Debug("MSG_RECV - Cola vacía, se bloquea", "pid", process.PCB.GetPID(), "cola", name)
+		block()
+		return true, nil, nil
+	}
+
+	// Si no se puede escribir, el mensaje queda en la cola para el próximo receptor.
+	if err := memory().Write(process.MemoryPID(), address, fit(payload, size)); err != nil {
+		return false, nil, err
+	}
+
+	if !direct {
+		queue.Messages = queue.Messages[1:]
+	}
+	if len(queue.senders) > 0 {
+		next := queue.senders[0]
+		queue.senders = queue.senders[1:]
+		if !direct {
+			queue.Messages = append(queue.Messages, next.payload)
+		}
+		woken = next.process
+	}
+	slog.Debug("MSG_RECV - Mensaje recibido", "pid", process.PCB.GetPID(), "cola", name, "bytes", len(payload))
+	return false, woken, nil
+}
+
+// deliver le entrega payload al primer receptor esperando al que se le pueda escribir. Requiere el lock tomado.
+// Devuelve el receptor que lo recibió y los que fallaron, para finalizarlos.
+func (q *Queue) deliver(payload []byte) (woken *globals.Process, failed []*globals.Process) {
+	for len(q.receivers) > 0 {
+		next := q.receivers[0]
+		q.receivers = q.receivers[1:]
+		if err := memory().Write(next.process.MemoryPID(), next.address, fit(payload, next.size)); err != nil {
+			slog.Error("No se pudo entregar el mensaje al receptor", "pid", next.process.PCB.GetPID(), "cola", q.Name, "error", err)
+			failed = append(failed, next.process)
+			continue
+		}
+		return next.process, failed
+	}
+	return nil, failed
+}
+
+func terminate(processes []*globals.Process) {
+	for _, process := range processes {
+		if err := Terminate(process); err != nil {
+			slog.Error("No se pudo finalizar al receptor", "pid", process.PCB.GetPID(), "error", err)
+		}
+	}
+}
+
+// Remove saca al proceso de las colas en las que espera. El mensaje de un emisor bloqueado se descarta.
+func Remove(process *globals.Process) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, queue := range table {
+		queue.receivers = slices.DeleteFunc(queue.receivers, func(r receiver) bool { return r.process == process })
+		queue.senders = slices.DeleteFunc(queue.senders, func(s sender) bool { return s.process == process })
+	}
+}
+
+// fit ajusta el mensaje al tamaño del buffer del receptor, truncando o completando con ceros.
+func fit(payload []byte, size int) []byte {
+	buffer := make([]byte, size)
+	copy(buffer, payload)
+	return buffer
+}
+
+// memoryClient lee y escribe la memoria lógica de los procesos, es memoryutils.Client salvo en los tests.
+type memoryClient interface {
+	Read(pid uint, address int, size int) ([]byte, error)
+	Write(pid uint, address int, data []byte) error
+}
+
+// memory copia los mensajes entre la memoria de los procesos y la cola.
+var memory = func() memoryClient {
+	return memoryutils.Client{Ip: config.Values.IpMemory, Port: config.Values.PortMemory}
+}
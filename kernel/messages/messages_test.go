@@ -0,0 +1,248 @@
+package messages
+
+import (
+	"errors"
+	"slices"
+	"ssoo-kernel/globals"
+	"ssoo-utils/pcb"
+	"sync"
+	"testing"
+)
+
+// fakeMemory guarda la memoria de cada proceso en un buffer propio. Las escrituras a los PIDs de failWrite fallan.
+type fakeMemory struct {
+	mu        sync.Mutex
+	data      map[uint][]byte
+	failWrite map[uint]bool
+}
+
+func (m *fakeMemory) Read(pid uint, address int, size int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.buffer(pid)[address : address+size]), nil
+}
+
+func (m *fakeMemory) Write(pid uint, address int, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failWrite[pid] {
+		return errors.New("escritura rechazada")
+	}
+	copy(m.buffer(pid)[address:], data)
+	return nil
+}
+
+func (m *fakeMemory) buffer(pid uint) []byte {
+	if _, exists := m.data[pid]; !exists {
+		m.data[pid] = make([]byte, 64)
+	}
+	return m.data[pid]
+}
+
+// setup reemplaza las colas por las de capacities y la memoria por una en el proceso.
+func setup(t *testing.T, capacities map[string]int) *fakeMemory {
+	mu.Lock()
+	defer mu.Unlock()
+	previousTable, previousMemory, previousTerminate := table, memory, Terminate
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		table, memory, Terminate = previousTable, previousMemory, previousTerminate
+	})
+
+	table = make(map[string]*Queue)
+	for name, capacity := range capacities {
+		table[name] = &Queue{Name: name, Capacity: capacity, Messages: make([][]byte, 0)}
+	}
+	fake := &fakeMemory{data: make(map[uint][]byte), failWrite: make(map[uint]bool)}
+	memory = func() memoryClient { return fake }
+	return fake
+}
+
+func newProcess(pid uint) *globals.Process {
+	return &globals.Process{PCB: pcb.Create(pid, "test")}
+}
+
+// send manda desde el proceso el texto message, escrito antes en su memoria desde la dirección 0.
+func send(t *testing.T, fake *fakeMemory, process *globals.Process, name string, message string) (bool, *globals.Process) {
+	t.Helper()
+	fake.Write(process.PCB.GetPID(), 0, []byte(message))
+	blocks := 0
+	blocked, woken, err := Send(process, name, 0, len(message), func() { blocks++ })
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if blocked != (blocks == 1) {
+		t.Fatalf("Send devolvió blocked=%v pero llamó a block %d veces", blocked, blocks)
+	}
+	return blocked, woken
+}
+
+// receive recibe en el proceso hasta size bytes en la dirección 16.
+func receive(t *testing.T, process *globals.Process, name string, size int) (bool, *globals.Process) {
+	t.Helper()
+	blocks := 0
+	blocked, woken, err := Receive(process, name, 16, size, func() { blocks++ })
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if blocked != (blocks == 1) {
+		t.Fatalf("Receive devolvió blocked=%v pero llamó a block %d veces", blocked, blocks)
+	}
+	return blocked, woken
+}
+
+func received(fake *fakeMemory, process *globals.Process, size int) string {
+	data, _ := fake.Read(process.PCB.GetPID(), 16, size)
+	return string(data)
+}
+
+func TestRendezvousSenderFirst(t *testing.T) {
+	fake := setup(t, map[string]int{"cita": 0})
+	sender, receiver := newProcess(1), newProcess(2)
+
+	if blocked, _ := send(t, fake, sender, "cita", "hola"); !blocked {
+		t.Fatal("el emisor de una cola sin capacidad no se bloqueó")
+	}
+	if n := len(table["cita"].Messages); n != 0 {
+		t.Fatalf("la cola sin capacidad guardó %d mensajes", n)
+	}
+
+	blocked, woken := receive(t, receiver, "cita", 4)
+	if blocked || woken != sender {
+		t.Fatalf("Receive = (%v, %v), se esperaba que no se bloquee y despierte al emisor", blocked, woken)
+	}
+	if got := received(fake, receiver, 4); got != "hola" {
+		t.Errorf("se recibió %q, se esperaba \"hola\"", got)
+	}
+	if q := table["cita"]; len(q.senders) != 0 || len(q.Messages) != 0 {
+		t.Errorf("quedaron %d emisores y %d mensajes", len(q.senders), len(q.Messages))
+	}
+}
+
+func TestRendezvousReceiverFirst(t *testing.T) {
+	fake := setup(t, map[string]int{"cita": 0})
+	sender, receiver := newProcess(1), newProcess(2)
+
+	if blocked, _ := receive(t, receiver, "cita", 6); !blocked {
+		t.Fatal("el receptor de una cola vacía no se bloqueó")
+	}
+
+	blocked, woken := send(t, fake, sender, "cita", "hola")
+	if blocked || woken != receiver {
+		t.Fatalf("Send = (%v, %v), se esperaba que no se bloquee y despierte al receptor", blocked, woken)
+	}
+	// El mensaje se completa con ceros hasta el tamaño del buffer del receptor.
+	if got := received(fake, receiver, 6); got != "hola\x00\x00" {
+		t.Errorf("se recibió %q, se esperaba \"hola\\x00\\x00\"", got)
+	}
+}
+
+func TestBlockedSenderPromotedOnReceive(t *testing.T) {
+	fake := setup(t, map[string]int{"pedidos": 1})
+	first, second, receiver := newProcess(1), newProcess(2), newProcess(3)
+
+	if blocked, _ := send(t, fake, first, "pedidos", "uno"); blocked {
+		t.Fatal("el primer emisor se bloqueó con lugar en la cola")
+	}
+	if blocked, _ := send(t, fake, second, "pedidos", "dos"); !blocked {
+		t.Fatal("el segundo emisor no se bloqueó con la cola llena")
+	}
+
+	// Tomar "uno" deja lugar: "dos" pasa a la cola y su emisor se despierta.
+	if blocked, woken := receive(t, receiver, "pedidos", 3); blocked || woken != second {
+		t.Fatalf("Receive = (%v, %v), se esperaba despertar al segundo emisor", blocked, woken)
+	}
+	if got := received(fake, receiver, 3); got != "uno" {
+		t.Errorf("se recibió %q, se esperaba \"uno\"", got)
+	}
+	if q := table["pedidos"]; len(q.senders) != 0 || len(q.Messages) != 1 || string(q.Messages[0]) != "dos" {
+		t.Fatalf("cola %q con %d emisores, se esperaba [dos] sin emisores", q.Messages, len(q.senders))
+	}
+
+	if blocked, woken := receive(t, receiver, "pedidos", 3); blocked || woken != nil {
+		t.Fatalf("Receive = (%v, %v), se esperaba recibir sin despertar a nadie", blocked, woken)
+	}
+	if got := received(fake, receiver, 3); got != "dos" {
+		t.Errorf("se recibió %q, se esperaba \"dos\"", got)
+	}
+}
+
+func TestFailedReceiverIsTerminated(t *testing.T) {
+	fake := setup(t, map[string]int{"cita": 0})
+	sender, broken, receiver := newProcess(1), newProcess(2), newProcess(3)
+	fake.failWrite[broken.PCB.GetPID()] = true
+	var terminated []*globals.Process
+	Terminate = func(process *globals.Process) error {
+		terminated = append(terminated, process)
+		return nil
+	}
+
+	receive(t, broken, "cita", 4)
+	receive(t, receiver, "cita", 4)
+
+	// El primer receptor falla, el mensaje pasa al siguiente y al que falló se lo finaliza.
+	if blocked, woken := send(t, fake, sender, "cita", "hola"); blocked || woken != receiver {
+		t.Fatalf("Send = (%v, %v), se esperaba despertar al segundo receptor", blocked, woken)
+	}
+	if got := received(fake, receiver, 4); got != "hola" {
+		t.Errorf("se recibió %q, se esperaba \"hola\"", got)
+	}
+	if !slices.Equal(terminated, []*globals.Process{broken}) {
+		t.Errorf("se finalizaron %v, se esperaba solo al receptor que falló", terminated)
+	}
+}
+
+func TestFailedReceiveKeepsMessage(t *testing.T) {
+	fake := setup(t, map[string]int{"pedidos": 1})
+	sender, broken := newProcess(1), newProcess(2)
+	fake.failWrite[broken.PCB.GetPID()] = true
+
+	send(t, fake, sender, "pedidos", "uno")
+	if _, _, err := Receive(broken, "pedidos", 16, 3, func() {}); err == nil {
+		t.Fatal("Receive no devolvió el error de memoria")
+	}
+	if q := table["pedidos"]; len(q.Messages) != 1 {
+		t.Errorf("quedaron %d mensajes, se esperaba que el mensaje siga en la cola", len(q.Messages))
+	}
+}
+
+func TestRemoveDropsWaiters(t *testing.T) {
+	fake := setup(t, map[string]int{"cita": 0, "vacia": 1})
+	sender, receiver, other := newProcess(1), newProcess(2), newProcess(3)
+
+	send(t, fake, sender, "cita", "hola")
+	receive(t, receiver, "vacia", 4)
+
+	Remove(sender)
+	Remove(receiver)
+	if q := table["cita"]; len(q.senders) != 0 {
+		t.Errorf("quedaron %d emisores en cita", len(q.senders))
+	}
+	if q := table["vacia"]; len(q.receivers) != 0 {
+		t.Errorf("quedaron %d receptores en vacia", len(q.receivers))
+	}
+
+	// El mensaje del emisor que se sacó se descarta: el próximo receptor espera.
+	if blocked, _ := receive(t, other, "cita", 4); !blocked {
+		t.Error("el receptor recibió el mensaje de un emisor que se sacó de la cola")
+	}
+	// Y un mensaje nuevo en vacia queda en la cola en lugar de ir al receptor que se sacó.
+	if blocked, woken := send(t, fake, sender, "vacia", "hola"); blocked || woken != nil {
+		t.Errorf("Send = (%v, %v), se esperaba encolar sin despertar a nadie", blocked, woken)
+	}
+	if q := table["vacia"]; len(q.Messages) != 1 {
+		t.Errorf("vacia tiene %d mensajes, se esperaba 1", len(q.Messages))
+	}
+}
+
+func TestUnknownQueue(t *testing.T) {
+	setup(t, map[string]int{})
+	process := newProcess(1)
+	if _, _, err := Send(process, "nada", 0, 1, func() {}); !errors.Is(err, ErrUnknownQueue) {
+		t.Errorf("Send: %v, se esperaba %v", err, ErrUnknownQueue)
+	}
+	if _, _, err := Receive(process, "nada", 0, 1, func() {}); !errors.Is(err, ErrUnknownQueue) {
+		t.Errorf("Receive: %v, se esperaba %v", err, ErrUnknownQueue)
+	}
+}
@@ -3,171 +3,244 @@ package queues
 import (
 	"fmt"
 	"log/slog"
-	"sort"
+	"ssoo-kernel/config"
+	"ssoo-kernel/events"
 	"ssoo-kernel/globals"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"ssoo-utils/pcb"
-	"sync"
 )
 
-type SortBy int
+func init() {
+	metrics.NewGaugeVecFunc("ssoo_kernel_queue_length", "Procesos en cada cola del kernel.", "queue", func() map[string]float64 {
+		lengths := make(map[string]float64)
+		for _, queue := range Snapshot() {
+			lengths[queue.Name] = float64(len(queue.Processes))
+		}
+		return lengths
+	})
+}
 
-const (
-	Size SortBy = iota
-	EstimatedBurst
-	NoSort
-)
+// PickFunc elige el próximo proceso de una cola no vacía (ver scheduler.SchedulingPolicy).
+type PickFunc func(queue []*globals.Process) *globals.Process
+
+// Las colas viven en globals.Processes, este paquete decide en cuál va cada proceso y loguea los cambios.
+
+// ReadyRouter lo implementan las políticas de corto plazo que reparten READY en colas propias (ej. MLFQ y VRR).
+// Sin router READY es una sola cola, o una por CPU con cpu_affinity.
+type ReadyRouter interface {
+	// ReadyQueues son las colas propias, se registran al usar el router.
+	ReadyQueues() []string
+	// ReadyQueue devuelve la cola en la que va el proceso al pasar a READY.
+	ReadyQueue(process *globals.Process) string
+	// TakeReady saca el próximo proceso a despachar, o nil si no hay ninguno en READY.
+	TakeReady(pick PickFunc) *globals.Process
+	// Describe muestra al proceso en el listado de su cola (ver MostrarLasColas), o "" para el formato por defecto.
+	Describe(queue string, process *globals.Process) string
+}
 
-func getQueueAndMutex(state pcb.STATE) (*[]*globals.Process, *sync.Mutex) {
-	switch state {
-	case pcb.NEW:
-		return &globals.NewQueue, &globals.NewQueueMutex
-	case pcb.READY:
-		return &globals.ReadyQueue, &globals.ReadyQueueMutex
-	case pcb.BLOCKED:
-		return &globals.BlockedQueue, &globals.BlockedQueueMutex
-	case pcb.EXEC:
-		return &globals.ExecQueue, &globals.ExecQueueMutex
-	case pcb.SUSP_READY:
-		return &globals.SuspReadyQueue, &globals.SuspReadyQueueMutex
-	case pcb.SUSP_BLOCKED:
-		return &globals.SuspBlockedQueue, &globals.SuspBlockedQueueMutex
-	case pcb.EXIT:
-		return &globals.ExitQueue, &globals.ExitQueueMutex
-	default:
-		panic("una persona con pocas neuronas puso un estado inválido, encuentrenlo y mátenlo.")
+var router ReadyRouter
+
+// UseRouter registra las colas de r y reparte READY según r. Se llama al cargar la política de corto plazo.
+func UseRouter(r ReadyRouter) {
+	for _, name := range r.ReadyQueues() {
+		globals.Processes.AddQueue(name, pcb.READY)
 	}
+	router = r
 }
 
 func IsEmpty(state pcb.STATE) bool {
-	queue, _ := getQueueAndMutex(state)
-
-	return len(*queue) == 0
+	return globals.Processes.Len(state) == 0
 }
 
 func Enqueue(state pcb.STATE, process *globals.Process) {
-	lastState := process.PCB.GetState()
-	process.PCB.SetState(state)
-	actualState := process.PCB.GetState()
-
-	queue, mutex := getQueueAndMutex(state)
-
-	mutex.Lock()
-	*queue = append(*queue, process)
-	mutex.Unlock()
+	logTransition(globals.Processes.Move(process, queueFor(state, process)))
+}
 
-	fmt.Println()
-	if !(actualState == lastState) {
-		logger.RequiredLog(true, process.PCB.GetPID(), "Pasa del estado", map[string]string{
-			"Estado Anterior": lastState.String(),
-			"Estado Actual":   actualState.String(),
-		})
-	} else {
-		logger.RequiredLog(true, process.PCB.GetPID(), "Sigue en el estado", map[string]string{
-			"Estado:": lastState.String(),
-		})
+func queueFor(state pcb.STATE, process *globals.Process) string {
+	if state != pcb.READY {
+		return state.String()
 	}
-	//mostrar la cola antes de agregar el proceso
-	pids := make([]uint, 0, len(*queue))
-	for _, proc := range *queue {
-		pids = append(pids, proc.PCB.GetPID())
+	switch {
+	case router != nil:
+		return router.ReadyQueue(process)
+	case config.Values.CPUAffinity && process.LastCPU != "" && globals.IsCPUConnected(process.LastCPU):
+		return globals.CPUQueue(process.LastCPU)
+	default:
+		return pcb.READY.String()
 	}
-	slog.Info("Lista", "Nombre", state.String(), "PIDs", pids)
-	fmt.Println()
-
 }
 
-func Search(state pcb.STATE, sortBy SortBy) *globals.Process {
-	queue, _ := getQueueAndMutex(state)
-
-	if len(*queue) == 0 {
+// Move pasa al proceso pid de from a to en un solo paso.
+// Devuelve nil si el proceso ya no estaba en from (otro lo movió antes).
+func Move(from pcb.STATE, to pcb.STATE, pid uint) *globals.Process {
+	transition, ok := globals.Processes.MoveIf(pid, from, func(process *globals.Process) string {
+		return queueFor(to, process)
+	})
+	if !ok {
+		slog.Info("No hay proceso con pid en cola", "pid", pid, "queue", from.String())
 		return nil
 	}
-	if len(*queue) == 1 {
-		return (*queue)[0]
-	}
+	logTransition(transition)
+	return transition.Process
+}
 
-	switch sortBy {
-	case Size:
-		sort.Slice(*queue, func(i, j int) bool {
-			return (*queue)[i].Size < (*queue)[j].Size
-		})
-	case EstimatedBurst:
-		sort.Slice(*queue, func(i, j int) bool {
-			return (*queue)[i].EstimatedBurst < (*queue)[j].EstimatedBurst
-		})
-	case NoSort:
+// DequeueReady saca el próximo proceso de READY para la CPU cpuID, de las colas del router si hay uno.
+func DequeueReady(cpuID string, pick PickFunc) *globals.Process {
+	switch {
+	case router != nil:
+		return router.TakeReady(pick)
+	case config.Values.CPUAffinity:
+		return dequeueWithAffinity(cpuID, pick)
+	default:
+		return Dequeue(pcb.READY, pick)
 	}
-
-	return (*queue)[0]
 }
 
-func Dequeue(state pcb.STATE, sortBy SortBy) *globals.Process {
-	queue, _ := getQueueAndMutex(state)
-
-	if len(*queue) == 0 {
-		return nil
+// dequeueWithAffinity prioriza la cola propia de la CPU, después la cola común de READY
+// (procesos que todavía no corrieron) y por último le roba a la CPU con más procesos esperando.
+func dequeueWithAffinity(cpuID string, pick PickFunc) *globals.Process {
+	if proc := globals.Processes.Take(globals.CPUQueue(cpuID), pick); proc != nil {
+		return proc
 	}
-	if len(*queue) == 1 {
-		proc := (*queue)[0]
-		*queue = (*queue)[1:]
+	if proc := Dequeue(pcb.READY, pick); proc != nil {
 		return proc
 	}
 
-	switch sortBy {
-	case Size:
-		sort.Slice(*queue, func(i, j int) bool {
-			return (*queue)[i].Size < (*queue)[j].Size
-		})
-	case EstimatedBurst:
-		sort.Slice(*queue, func(i, j int) bool {
-			return (*queue)[i].EstimatedBurst < (*queue)[j].EstimatedBurst
-		})
-	case NoSort:
+	proc := globals.Processes.TakeLongest(globals.CPUQueuePrefix, globals.CPUQueue(cpuID), pick)
+	if proc != nil {
+		globals.Steals.Inc()
+		slog.Info("Work stealing: la CPU toma un proceso de la cola de otra", "cpu", cpuID, "pid", proc.PCB.GetPID(), "last_cpu", proc.LastCPU)
 	}
-
-	proc := (*queue)[0]
-	*queue = (*queue)[1:]
-
 	return proc
 }
 
-func FindByPID(state pcb.STATE, pid uint) *globals.Process {
-	queue, _ := getQueueAndMutex(state)
+func logTransition(transition globals.Transition) {
+	process := transition.Process
 
-	for _, proc := range *queue {
-		if proc.PCB.GetPID() == pid {
-			return proc
+	fmt.Println()
+	if transition.From != transition.To {
+		globals.StateTransitions.With(transition.To.String()).Inc()
+		globals.StateSeconds.With(transition.From.String()).Add(transition.Spent.Seconds())
+		variables := map[string]string{
+			"Estado Anterior": transition.From.String(),
+			"Estado Actual":   transition.To.String(),
+		}
+		if transition.Queue != transition.To.String() {
+			variables["Cola"] = transition.Queue
+		}
+		logger.RequiredLog(true, process.PCB.GetPID(), "Pasa del estado", variables)
+		events.Process(events.StateChanged, process.PCB.GetPID(), transition.From, transition.To,
+			transitionReason(process, transition.From, transition.To), transition.Queue)
+	} else {
+		logger.RequiredLog(true, process.PCB.GetPID(), "Sigue en el estado", map[string]string{
+			"Estado:": transition.From.String(),
+		})
+		if transition.To == pcb.NEW {
+			events.Process(events.StateChanged, process.PCB.GetPID(), transition.From, transition.To, "created", transition.Queue)
 		}
 	}
+	slog.Info("Lista", "Nombre", transition.Queue, "PIDs", transition.PIDs)
+	fmt.Println()
+}
 
-	return nil
+// transitionReason describe por qué el proceso pasa de from a to, para los eventos de /events.
+func transitionReason(process *globals.Process, from pcb.STATE, to pcb.STATE) string {
+	switch {
+	case to == pcb.EXIT && process.Killed.Load():
+		return "killed"
+	case to == pcb.EXIT:
+		return "exit"
+	case to == pcb.EXEC:
+		return "dispatched"
+	case from == pcb.NEW && to == pcb.READY:
+		return "admitted"
+	case from == pcb.EXEC && to == pcb.READY:
+		return "preempted"
+	case from == pcb.EXEC && to == pcb.BLOCKED:
+		return "syscall"
+	case from == pcb.BLOCKED && to == pcb.SUSP_BLOCKED:
+		return "suspension_timeout"
+	case from == pcb.BLOCKED && to == pcb.READY, from == pcb.SUSP_BLOCKED && to == pcb.SUSP_READY:
+		return "unblocked"
+	case from == pcb.SUSP_READY && to == pcb.READY:
+		return "unsuspended"
+	}
+	return "unknown"
+}
+
+func Search(state pcb.STATE, pick PickFunc) *globals.Process {
+	if state == pcb.READY && config.Values.CPUAffinity {
+		return globals.Processes.PeekState(state, pick)
+	}
+	return globals.Processes.Peek(state.String(), pick)
+}
+
+func Dequeue(state pcb.STATE, pick PickFunc) *globals.Process {
+	return globals.Processes.Take(state.String(), pick)
+}
+
+func FindByPID(state pcb.STATE, pid uint) *globals.Process {
+	return globals.Processes.Find(state, pid)
 }
 
 func RemoveByPID(state pcb.STATE, pid uint) *globals.Process {
-	queue, mutex := getQueueAndMutex(state)
-
-	for i, proc := range *queue {
-		if proc.PCB.GetPID() == pid {
-			mutex.Lock()
-			*queue = append((*queue)[:i], (*queue)[i+1:]...)
-			mutex.Unlock()
-			return proc
-		}
+	proc := globals.Processes.TakeByPID(state, pid)
+	if proc == nil {
+		slog.Info("No hay proceso con pid en cola", "pid", pid, "queue", state.String())
 	}
-	slog.Info("No hay proceso con pid en cola", "pid", pid, "queue", state.String())
-	return nil
+	return proc
+}
+
+// List devuelve una copia de la cola principal de state.
+func List(state pcb.STATE) []*globals.Process {
+	return globals.Processes.List(state.String())
 }
 
 func MostrarLasColas(lugar string) {
 	slog.Info("MostrarColas en ", "Lugar", lugar)
-	states := []pcb.STATE{pcb.NEW, pcb.READY, pcb.BLOCKED, pcb.EXEC, pcb.SUSP_READY, pcb.SUSP_BLOCKED, pcb.EXIT}
-	for _, state := range states {
-		queue, _ := getQueueAndMutex(state)
-		processes := make([]string, 0, len(*queue))
-		for _, proc := range *queue {
-			processes = append(processes, fmt.Sprintf("PID:%d(Burst:%d)", proc.PCB.GetPID(), proc.EstimatedBurst))
+	for _, queue := range Snapshot() {
+		processes := make([]string, 0, len(queue.Processes))
+		for _, proc := range queue.Processes {
+			description := ""
+			if router != nil {
+				description = router.Describe(queue.Name, proc)
+			}
+			if description == "" {
+				description = fmt.Sprintf("PID:%d(Burst:%d)", proc.PCB.GetPID(), proc.EstimatedBurst)
+			}
+			processes = append(processes, description)
 		}
-		slog.Info("Lista", "Nombre", state.String(), "Procesos", processes)
+		slog.Info("Lista", "Nombre", queue.Name, "Procesos", processes)
+	}
+}
+
+type NamedQueue = globals.NamedQueue
+
+// Snapshot devuelve una copia de cada cola, incluidas las de READY del router y las de cada CPU.
+func Snapshot() []NamedQueue {
+	return globals.Processes.Queues()
+}
+
+// All devuelve todos los procesos conocidos por el kernel, en cualquier estado.
+func All() []*globals.Process {
+	return globals.Processes.All()
+}
+
+// TrimExit descarta los procesos más viejos de EXIT dejando los últimos keep (0 los deja todos).
+func TrimExit(keep int) {
+	if keep <= 0 {
+		return
+	}
+
+	trimmed := globals.Processes.Trim(pcb.EXIT.String(), keep)
+	if len(trimmed) == 0 {
+		return
+	}
+
+	archived := make([]uint, 0, len(trimmed))
+	for _, process := range trimmed {
+		archived = append(archived, process.PCB.GetPID())
 	}
+	slog.Debug("Se descartan procesos finalizados de EXIT", "PIDs", archived)
 }
@@ -0,0 +1,292 @@
+package resources
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/clock"
+	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
+	"sync"
+	"time"
+)
+
+/*
+Detección de deadlock sobre el grafo de espera (wait-for) de los recursos.
+
+Hay una arista P -> Q si P espera un recurso del que Q tiene alguna instancia.
+Con recursos de varias instancias un ciclo no alcanza: si algún otro dueño del recurso puede avanzar,
+va a soltar su instancia y P se despierta. Por eso antes se reduce el grafo: un proceso puede avanzar si
+no espera nada o si espera un recurso con algún dueño que puede avanzar. Los que quedan esperan sólo a
+procesos que tampoco pueden avanzar, y cada ciclo entre ellos es un deadlock. Se busca en cada bloqueo (deadlock_detection "ON_BLOCK")
+o cada deadlock_interval ms ("PERIODIC"). Si deadlock_victim está definido se finaliza
+un proceso del ciclo elegido según esa política hasta que no quedan ciclos.
+*/
+
+const (
+	DetectionOff      = "OFF"
+	DetectionOnBlock  = "ON_BLOCK"
+	DetectionPeriodic = "PERIODIC"
+)
+
+// Políticas para elegir el proceso a finalizar en cada ciclo.
+var victimPolicies = map[string]func(a, b *globals.Process) int{
+	// El creado más tarde (mayor PID)
+	"YOUNGEST": func(a, b *globals.Process) int { return cmp.Compare(a.PCB.GetPID(), b.PCB.GetPID()) },
+	// El de menor tamaño en memoria
+	"SMALLEST": func(a, b *globals.Process) int { return cmp.Compare(b.Size, a.Size) },
+	// El de menor prioridad (mayor número)
+	"LOWEST_PRIORITY": func(a, b *globals.Process) int { return cmp.Compare(a.Priority, b.Priority) },
+}
+
+// Terminate finaliza al proceso elegido como víctima. Se define en main (ver kernel_api.Kill).
+var Terminate func(process *globals.Process) error = func(process *globals.Process) error {
+	return fmt.Errorf("no hay forma de finalizar procesos")
+}
+
+var deadlocksDetected = metrics.NewCounter("ssoo_kernel_deadlocks_total", "Ciclos de espera entre recursos detectados.")
+
+// Deadlock es un ciclo del grafo de espera: PIDs[i] espera Resources[i], que tiene PIDs[i+1].
+type Deadlock struct {
+	PIDs      []uint   `json:"pids"`
+	Resources []string `json:"resources"`
+}
+
+type Resolution struct {
+	Time     time.Time `json:"time"`
+	Deadlock Deadlock  `json:"deadlock"`
+	Victim   uint      `json:"victim"`
+}
+
+type Report struct {
+	CheckedAt time.Time    `json:"checked_at"`
+	Detection string       `json:"detection"`
+	Policy    string       `json:"victim_policy"`
+	Deadlocks []Deadlock   `json:"deadlocks"`
+	Resolved  []Resolution `json:"resolved"`
+}
+
+var (
+	checkMu  sync.Mutex // una sola detección/resolución a la vez
+	resolved = make([]Resolution, 0)
+	reported = make(map[string]bool) // ciclos ya logueados, para no repetirlos en cada chequeo
+)
+
+func validateDetection() error {
+	switch config.Values.DeadlockDetection {
+	case "", DetectionOff, DetectionOnBlock:
+	case DetectionPeriodic:
+		if config.Values.DeadlockInterval <= 0 {
+			return fmt.Errorf("deadlock_interval debe ser positivo con deadlock_detection %s", DetectionPeriodic)
+		}
+	default:
+		return fmt.Errorf("deadlock_detection desconocido: %s", config.Values.DeadlockDetection)
+	}
+
+	if victim := config.Values.DeadlockVictim; victim != "" {
+		if _, exists := victimPolicies[victim]; !exists {
+			return fmt.Errorf("deadlock_victim desconocido: %s", victim)
+		}
+	}
+	return nil
+}
+
+// waitEdge es lo que espera un proceso: el recurso y los PIDs que tienen instancias de él.
+type waitEdge struct {
+	resource string
+	holders  []uint
+}
+
+// waitGraph arma el grafo de espera, indexado por el PID que espera, con sólo los procesos que no pueden avanzar.
+func waitGraph() map[uint]waitEdge {
+	mu.Lock()
+	defer mu.Unlock()
+
+	graph := make(map[uint]waitEdge)
+	for _, resource := range table {
+		holders := make([]uint, 0, len(resource.Holders))
+		for pid := range resource.Holders {
+			holders = append(holders, pid)
+		}
+		slices.Sort(holders)
+
+		for _, waiting := range resource.Waiting {
+			graph[waiting.PCB.GetPID()] = waitEdge{resource.Name, holders}
+		}
+	}
+	return reduce(graph)
+}
+
+// reduce saca del grafo a los procesos que pueden avanzar. Todos los dueños que quedan en las aristas también están en el grafo.
+func reduce(graph map[uint]waitEdge) map[uint]waitEdge {
+	for changed := true; changed; {
+		changed = false
+		for pid, edge := range graph {
+			// Los que no esperan nada no están en el grafo
+			free := slices.ContainsFunc(edge.holders, func(holder uint) bool {
+				_, waits := graph[holder]
+				return !waits
+			})
+			if free {
+				delete(graph, pid)
+				changed = true
+			}
+		}
+	}
+	return graph
+}
+
+// Detect busca los ciclos del grafo de espera. Cada ciclo aparece una sola vez, empezando por su menor PID.
+func Detect() []Deadlock {
+	graph := waitGraph()
+
+	nodes := make([]uint, 0, len(graph))
+	for pid := range graph {
+		nodes = append(nodes, pid)
+	}
+	slices.Sort(nodes)
+
+	const (
+		unvisited = iota
+		inStack
+		done
+	)
+	color := make(map[uint]int)
+	stack := make([]uint, 0)
+	seen := make(map[string]bool)
+	deadlocks := make([]Deadlock, 0)
+
+	var visit func(pid uint)
+	visit = func(pid uint) {
+		color[pid] = inStack
+		stack = append(stack, pid)
+
+		for _, next := range graph[pid].holders {
+			switch color[next] {
+			case unvisited:
+				visit(next)
+			case inStack:
+				cycle := slices.Clone(stack[slices.Index(stack, next):])
+				deadlock := newDeadlock(cycle, graph)
+				if key := fmt.Sprint(deadlock.PIDs); !seen[key] {
+					seen[key] = true
+					deadlocks = append(deadlocks, deadlock)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		color[pid] = done
+	}
+
+	for _, pid := range nodes {
+		if color[pid] == unvisited {
+			visit(pid)
+		}
+	}
+	return deadlocks
+}
+
+func newDeadlock(cycle []uint, graph map[uint]waitEdge) Deadlock {
+	// Se rota para que empiece por el menor PID
+	start := slices.Index(cycle, slices.Min(cycle))
+	cycle = append(cycle[start:], cycle[:start]...)
+
+	deadlock := Deadlock{PIDs: cycle, Resources: make([]string, 0, len(cycle))}
+	for _, pid := range cycle {
+		deadlock.Resources = append(deadlock.Resources, graph[pid].resource)
+	}
+	return deadlock
+}
+
+// Check detecta deadlocks, loguea los nuevos y, si hay política de víctima, los resuelve.
+func Check() []Deadlock {
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	for {
+		deadlocks := Detect()
+		for _, deadlock := range deadlocks {
+			if key := fmt.Sprint(deadlock.PIDs, deadlock.Resources); !reported[key] {
+				reported[key] = true
+				deadlocksDetected.Inc()
+				logger.Instance.Warn("Deadlock detectado", "PIDs", deadlock.PIDs, "recursos", deadlock.Resources)
+			}
+		}
+
+		if len(deadlocks) == 0 || config.Values.DeadlockVictim == "" {
+			return deadlocks
+		}
+
+		if !resolve(deadlocks[0]) {
+			return deadlocks
+		}
+	}
+}
+
+// resolve finaliza a la víctima del ciclo. Devuelve false si no pudo finalizarla.
+func resolve(deadlock Deadlock) bool {
+	candidates := make([]*globals.Process, 0, len(deadlock.PIDs))
+	for _, pid := range deadlock.PIDs {
+		if process := globals.Processes.Get(pid); process != nil {
+			candidates = append(candidates, process)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	compare := victimPolicies[config.Values.DeadlockVictim]
+	victim := slices.MaxFunc(candidates, func(a, b *globals.Process) int {
+		return cmp.Or(compare(a, b), cmp.Compare(a.PCB.GetPID(), b.PCB.GetPID()))
+	})
+
+	logger.RequiredLog(true, victim.PCB.GetPID(), "Se finaliza el proceso para resolver un deadlock", map[string]string{
+		"Política": config.Values.DeadlockVictim,
+		"Ciclo":    fmt.Sprint(deadlock.PIDs),
+	})
+	if err := Terminate(victim); err != nil {
+		slog.Error("No se pudo finalizar la víctima del deadlock", "pid", victim.PCB.GetPID(), "error", err)
+		return false
+	}
+
+	resolved = append(resolved, Resolution{Time: clock.Now(), Deadlock: deadlock, Victim: victim.PCB.GetPID()})
+	return true
+}
+
+// OnBlock se llama cada vez que un proceso se bloquea esperando un recurso.
+func OnBlock() {
+	if config.Values.DeadlockDetection == DetectionOnBlock {
+		Check()
+	}
+}
+
+// RunDetector chequea deadlocks cada deadlock_interval ms si la detección es periódica.
+func RunDetector() {
+	if config.Values.DeadlockDetection != DetectionPeriodic {
+		return
+	}
+	clock.Hold() // el del detector, Sleep lo suelta mientras espera
+	for {
+		clock.Sleep(time.Duration(config.Values.DeadlockInterval) * time.Millisecond)
+		Check()
+	}
+}
+
+// Status devuelve los deadlocks actuales, sin resolverlos, y los ya resueltos.
+func Status() Report {
+	deadlocks := Detect()
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+	return Report{
+		CheckedAt: clock.Now(),
+		Detection: config.Values.DeadlockDetection,
+		Policy:    config.Values.DeadlockVictim,
+		Deadlocks: deadlocks,
+		Resolved:  slices.Clone(resolved),
+	}
+}
@@ -0,0 +1,71 @@
+package resources
+
+import (
+	"reflect"
+	"ssoo-kernel/globals"
+	"ssoo-utils/pcb"
+	"testing"
+)
+
+// setTable reemplaza la tabla de recursos. holders y waiting van por nombre de recurso.
+func setTable(t *testing.T, holders map[string]map[uint]int, waiting map[string][]uint) {
+	mu.Lock()
+	defer mu.Unlock()
+	previous := table
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		table = previous
+	})
+
+	table = make(map[string]*Resource)
+	for name, taken := range holders {
+		resource := &Resource{Name: name, Holders: taken}
+		for _, pid := range waiting[name] {
+			resource.Waiting = append(resource.Waiting, &globals.Process{PCB: pcb.Create(pid, "test")})
+		}
+		table[name] = resource
+	}
+}
+
+func TestDetectSingleInstanceCycle(t *testing.T) {
+	// 1 tiene A y espera B, 2 tiene B y espera A
+	setTable(t,
+		map[string]map[uint]int{"A": {1: 1}, "B": {2: 1}},
+		map[string][]uint{"A": {2}, "B": {1}},
+	)
+
+	want := []Deadlock{{PIDs: []uint{1, 2}, Resources: []string{"B", "A"}}}
+	if got := Detect(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Detect() = %v, want %v", got, want)
+	}
+}
+
+func TestDetectMultiInstanceWithFreeHolder(t *testing.T) {
+	// Como el anterior, pero B tiene dos instancias y la otra la tiene 3, que no espera nada:
+	// cuando 3 la suelte 1 avanza, así que no hay deadlock aunque el grafo tenga un ciclo.
+	setTable(t,
+		map[string]map[uint]int{"A": {1: 1}, "B": {2: 1, 3: 1}},
+		map[string][]uint{"A": {2}, "B": {1}},
+	)
+
+	if got := Detect(); len(got) != 0 {
+		t.Fatalf("Detect() = %v, want ninguno", got)
+	}
+}
+
+func TestDetectMultiInstanceAllHoldersBlocked(t *testing.T) {
+	// B tiene dos instancias, de 2 y de 3, y los dos esperan A, que tiene 1
+	setTable(t,
+		map[string]map[uint]int{"A": {1: 1}, "B": {2: 1, 3: 1}},
+		map[string][]uint{"A": {2, 3}, "B": {1}},
+	)
+
+	want := []Deadlock{
+		{PIDs: []uint{1, 2}, Resources: []string{"B", "A"}},
+		{PIDs: []uint{1, 3}, Resources: []string{"B", "A"}},
+	}
+	if got := Detect(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Detect() = %v, want %v", got, want)
+	}
+}
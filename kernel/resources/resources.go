@@ -0,0 +1,131 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"sync"
+)
+
+/*
+Recursos del kernel para las syscalls WAIT y SIGNAL.
+
+Cada recurso es un semáforo contador declarado en "resources" de kernel_config.json
+con su cantidad inicial de instancias (un mutex es un recurso con 1 instancia).
+Los procesos que no consiguen una instancia esperan en la cola del recurso y se despiertan en orden FIFO.
+*/
+
+var ErrUnknownResource = errors.New("recurso inexistente")
+
+type Resource struct {
+	Name      string
+	Instances int                // instancias libres
+	Waiting   []*globals.Process // procesos bloqueados esperando una instancia, en orden de llegada
+	Holders   map[uint]int       // instancias tomadas por cada PID
+}
+
+var (
+	mu    sync.Mutex
+	table = make(map[string]*Resource)
+)
+
+// Init declara los recursos de la configuración con sus instancias iniciales.
+func Init() error {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, instances := range config.Values.Resources {
+		if instances < 0 {
+			return fmt.Errorf("resources: %s tiene una cantidad negativa de instancias", name)
+		}
+		table[name] = &Resource{Name: name, Instances: instances, Holders: make(map[uint]int)}
+	}
+	return validateDetection()
+}
+
+/*
+Wait toma una instancia de name para el proceso.
+
+Si no hay instancias libres el proceso queda en la cola del recurso y se llama a block
+antes de soltar el lock, así un SIGNAL concurrente siempre lo encuentra ya en BLOCKED.
+*/
+func Wait(process *globals.Process, name string, block func()) (blocked bool, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resource, exists := table[name]
+	if !exists {
+		return false, ErrUnknownResource
+	}
+
+	pid := process.PCB.GetPID()
+	if resource.Instances > 0 {
+		resource.Instances--
+		resource.Holders[pid]++
+		slog.Debug("WAIT - Se asigna una instancia", "pid", pid, "recurso", name, "libres", resource.Instances)
+		return false, nil
+	}
+
+	resource.Waiting = append(resource.Waiting, process)
+	slog.Debug("WAIT - Se bloquea esperando el recurso", "pid", pid, "recurso", name, "esperando", len(resource.Waiting))
+	block()
+	return true, nil
+}
+
+// Signal devuelve una instancia de name. Si había procesos esperando, la instancia pasa al primero y se lo devuelve para desbloquearlo.
+func Signal(process *globals.Process, name string) (*globals.Process, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resource, exists := table[name]
+	if !exists {
+		return nil, ErrUnknownResource
+	}
+
+	if pid := process.PCB.GetPID(); resource.Holders[pid] > 0 {
+		resource.Holders[pid]--
+		if resource.Holders[pid] == 0 {
+			delete(resource.Holders, pid)
+		}
+	}
+	return resource.release(), nil
+}
+
+// release libera una instancia, dándosela al primer proceso en espera si lo hay. Requiere el lock tomado.
+func (r *Resource) release() *globals.Process {
+	if len(r.Waiting) == 0 {
+		r.Instances++
+		return nil
+	}
+	woken := r.Waiting[0]
+	r.Waiting = r.Waiting[1:]
+	r.Holders[woken.PCB.GetPID()]++
+	slog.Debug("SIGNAL - Se asigna una instancia a un proceso en espera", "pid", woken.PCB.GetPID(), "recurso", r.Name)
+	return woken
+}
+
+// ReleaseAll saca al proceso de las colas de espera y libera todas las instancias que tenía tomadas.
+// Devuelve los procesos que recibieron alguna de esas instancias, para desbloquearlos.
+func ReleaseAll(process *globals.Process) []*globals.Process {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pid := process.PCB.GetPID()
+	woken := make([]*globals.Process, 0)
+	for _, resource := range table {
+		resource.Waiting = slices.DeleteFunc(resource.Waiting, func(p *globals.Process) bool { return p == process })
+
+		for range resource.Holders[pid] {
+			if next := resource.release(); next != nil {
+				woken = append(woken, next)
+			}
+		}
+		if resource.Holders[pid] > 0 {
+			slog.Info("Se liberan las instancias del recurso que tenía el proceso", "pid", pid, "recurso", resource.Name, "instancias", resource.Holders[pid])
+		}
+		delete(resource.Holders, pid)
+	}
+	return woken
+}
@@ -0,0 +1,18 @@
+package scheduler
+
+import "ssoo-kernel/globals"
+
+// FIFO: atiende los procesos en orden de llegada.
+type fifo struct{ nonPreemptive }
+
+func init() {
+	Register("FIFO", func() (SchedulingPolicy, error) { return fifo{}, nil })
+	RegisterIngress("FIFO", fifo{})
+}
+
+func (fifo) PickNext(queue []*globals.Process) *globals.Process {
+	if len(queue) == 0 {
+		return nil
+	}
+	return queue[0]
+}
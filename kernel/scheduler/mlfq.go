@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-kernel/queues"
+	"ssoo-utils/clock"
+	"ssoo-utils/pcb"
+	"strings"
+	"time"
+)
+
+// MLFQ: una cola de READY por nivel, cada una con su quantum.
+// Baja de nivel quien consume todo su quantum y sube quien se bloquea por IO.
+type mlfq struct{ fifo }
+
+// Prefijo de las colas de READY por nivel, el nivel 0 es el de mayor prioridad.
+const mlfqQueuePrefix = "READY_N"
+
+func mlfqQueue(level int) string { return fmt.Sprintf("%s%d", mlfqQueuePrefix, level) }
+
+func init() {
+	Register("MLFQ", func() (SchedulingPolicy, error) {
+		if len(config.Values.MLFQQuanta) == 0 {
+			return nil, errors.New("mlfq_quanta requiere al menos un nivel")
+		}
+		for _, quantum := range config.Values.MLFQQuanta {
+			if quantum <= 0 {
+				return nil, errors.New("todos los quantum de mlfq_quanta deben ser mayores a 0")
+			}
+		}
+		return mlfq{}, nil
+	})
+}
+
+func (mlfq) Quantum(process *globals.Process) int64 {
+	return config.Values.MLFQQuanta[process.Level]
+}
+
+func (mlfq) OnBurstFinished(process *globals.Process, reason string) {
+	globals.UpdateBurstEstimation(process)
+
+	switch reason {
+	case "Interrupt":
+		if process.RemainingQuantum == 0 {
+			demote(process)
+		}
+	case "IO":
+		promote(process)
+	}
+}
+
+// demote baja un nivel al proceso que consumió todo su quantum.
+func demote(process *globals.Process) {
+	if process.Level < len(config.Values.MLFQQuanta)-1 {
+		process.Level++
+		slog.Info("MLFQ - Proceso baja de nivel", "pid", process.PCB.GetPID(), "nivel", process.Level)
+	}
+}
+
+// promote sube un nivel al proceso que se bloqueó antes de consumir su quantum.
+func promote(process *globals.Process) {
+	if process.Level > 0 {
+		process.Level--
+		slog.Info("MLFQ - Proceso sube de nivel", "pid", process.PCB.GetPID(), "nivel", process.Level)
+	}
+}
+
+func (mlfq) ReadyQueues() []string {
+	names := make([]string, 0, len(config.Values.MLFQQuanta))
+	for level := range config.Values.MLFQQuanta {
+		names = append(names, mlfqQueue(level))
+	}
+	return names
+}
+
+func (mlfq) ReadyQueue(process *globals.Process) string {
+	return mlfqQueue(process.Level)
+}
+
+// TakeReady saca el próximo proceso del nivel más alto no vacío.
+func (mlfq) TakeReady(pick queues.PickFunc) *globals.Process {
+	for level := range config.Values.MLFQQuanta {
+		if process := globals.Processes.Take(mlfqQueue(level), pick); process != nil {
+			return process
+		}
+	}
+	return nil
+}
+
+func (mlfq) Describe(queue string, process *globals.Process) string {
+	if !strings.HasPrefix(queue, mlfqQueuePrefix) {
+		return ""
+	}
+	return fmt.Sprintf("PID:%d(Quantum:%d)", process.PCB.GetPID(), config.Values.MLFQQuanta[process.Level])
+}
+
+// Run hace un boost periódico de prioridad para evitar inanición en los niveles bajos.
+func (mlfq) Run() {
+	if config.Values.MLFQBoostInterval <= 0 {
+		return
+	}
+
+	clock.Hold() // el de la tarea, Sleep lo suelta mientras espera
+	for {
+		clock.Sleep(time.Duration(config.Values.MLFQBoostInterval) * time.Millisecond)
+		boost()
+	}
+}
+
+// boost sube al nivel 0 a todos los procesos encolados fuera de EXEC. Los que están ejecutando o en
+// tránsito no se tocan: OnBurstFinished cambia su nivel sin lock y se acomodan en el próximo boost.
+func boost() {
+	boosted := make([]uint, 0)
+	toTop := func(process *globals.Process) {
+		process.Level = 0
+		boosted = append(boosted, process.PCB.GetPID())
+	}
+	for level := 1; level < len(config.Values.MLFQQuanta); level++ {
+		globals.Processes.Splice(mlfqQueue(level), mlfqQueue(0), toTop)
+	}
+
+	// Los que no están en READY también vuelven al nivel 0 para su próxima entrada
+	for _, state := range []pcb.STATE{pcb.NEW, pcb.BLOCKED, pcb.SUSP_BLOCKED, pcb.SUSP_READY} {
+		globals.Processes.UpdateState(state, func(queue []*globals.Process) {
+			for _, process := range queue {
+				process.Level = 0
+			}
+		})
+	}
+
+	slog.Info("Boost de prioridad MLFQ", "PIDs", boosted)
+}
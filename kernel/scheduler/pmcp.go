@@ -0,0 +1,14 @@
+package scheduler
+
+import "ssoo-kernel/globals"
+
+// PMCP: Proceso Más Chico Primero, prioriza a los procesos de menor tamaño. Sólo para el ingreso a READY.
+type pmcp struct{}
+
+func init() {
+	RegisterIngress("PMCP", pmcp{})
+}
+
+func (pmcp) PickNext(queue []*globals.Process) *globals.Process {
+	return pickMin(queue, func(p *globals.Process) int64 { return int64(p.Size) })
+}
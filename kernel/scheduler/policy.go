@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-kernel/queues"
+)
+
+// IngressPolicy decide qué proceso entra a READY desde NEW o SUSP_READY (ready_ingress_algorithm).
+// Se registra con RegisterIngress en el init() del archivo del algoritmo.
+type IngressPolicy interface {
+	// PickNext elige el próximo proceso de una cola no vacía, sin sacarlo de la misma.
+	PickNext(queue []*globals.Process) *globals.Process
+}
+
+// SchedulingPolicy decide qué proceso se planifica y cuándo se desaloja (scheduler_algorithm).
+// Cada algoritmo vive en su propio archivo y se registra con Register en su init().
+// Si además implementa queues.ReadyRouter, READY se reparte en sus propias colas.
+type SchedulingPolicy interface {
+	// PickNext elige el próximo proceso de una cola no vacía, sin sacarlo de la misma.
+	PickNext(queue []*globals.Process) *globals.Process
+	// Preemptive indica si el STS debe evaluar desalojos cuando no hay CPUs libres.
+	Preemptive() bool
+	// ShouldPreempt indica si candidate debe desalojar a running.
+	ShouldPreempt(running *globals.Process, candidate *globals.Process) bool
+	// OnBurstFinished se llama cada vez que un proceso deja la CPU.
+	// reason es "Interrupt", "Exit" o el nombre de la syscall bloqueante.
+	OnBurstFinished(process *globals.Process, reason string)
+}
+
+// victimPicker lo implementan las políticas expropiativas que eligen a qué proceso
+// desalojar entre los que están en EXEC. Si no se implementa se toma el primero posible.
+type victimPicker interface {
+	PickVictim(running []*globals.Process, candidate *globals.Process) *globals.Process
+}
+
+// timeSharing lo implementan las políticas que desalojan por fin de quantum.
+type timeSharing interface {
+	Quantum(process *globals.Process) int64
+}
+
+// backgroundTask lo implementan las políticas que necesitan una tarea periódica (boost, aging).
+type backgroundTask interface {
+	Run()
+}
+
+type policyConstructor func() (SchedulingPolicy, error)
+
+// Un registro por rol, así cada config sólo acepta los algoritmos que tienen sentido para ella.
+var (
+	registry        = map[string]policyConstructor{}
+	ingressRegistry = map[string]IngressPolicy{}
+)
+
+var (
+	ltsPolicy IngressPolicy
+	stsPolicy SchedulingPolicy
+)
+
+func Register(name string, constructor policyConstructor) {
+	if _, exists := registry[name]; exists {
+		panic("algoritmo de planificación registrado dos veces: " + name)
+	}
+	registry[name] = constructor
+}
+
+func RegisterIngress(name string, policy IngressPolicy) {
+	if _, exists := ingressRegistry[name]; exists {
+		panic("algoritmo de ingreso a READY registrado dos veces: " + name)
+	}
+	ingressRegistry[name] = policy
+}
+
+func Policies() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func IngressPolicies() []string {
+	names := make([]string, 0, len(ingressRegistry))
+	for name := range ingressRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewPolicy(name string) (SchedulingPolicy, error) {
+	constructor, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("algoritmo de planificación '%s' desconocido, disponibles: %v", name, Policies())
+	}
+	policy, err := constructor()
+	if err != nil {
+		return nil, fmt.Errorf("algoritmo de planificación '%s': %w", name, err)
+	}
+	return policy, nil
+}
+
+// LoadPolicies instancia las políticas de largo/mediano y corto plazo según la config.
+// Debe llamarse al arrancar, antes de lanzar los planificadores.
+func LoadPolicies() error {
+	var err error
+
+	ingress, ok := ingressRegistry[config.Values.ReadyIngressAlgorithm]
+	if !ok {
+		return fmt.Errorf("ready_ingress_algorithm: algoritmo '%s' desconocido, disponibles: %v", config.Values.ReadyIngressAlgorithm, IngressPolicies())
+	}
+	ltsPolicy = ingress
+
+	stsPolicy, err = NewPolicy(config.Values.SchedulerAlgorithm)
+	if err != nil {
+		return fmt.Errorf("scheduler_algorithm: %w", err)
+	}
+
+	if router, ok := stsPolicy.(queues.ReadyRouter); ok {
+		if config.Values.CPUAffinity {
+			return fmt.Errorf("cpu_affinity: no se puede usar con %s, que tiene sus propias colas de READY", config.Values.SchedulerAlgorithm)
+		}
+		queues.UseRouter(router)
+	}
+
+	globals.BurstFinished = stsPolicy.OnBurstFinished
+	return nil
+}
+
+// RunPolicyTasks lanza la tarea periódica de la política de corto plazo, si tiene una.
+func RunPolicyTasks() {
+	if task, ok := stsPolicy.(backgroundTask); ok {
+		go task.Run()
+	}
+}
+
+// pickMin devuelve el primer proceso con menor valor según key.
+func pickMin(queue []*globals.Process, key func(*globals.Process) int64) *globals.Process {
+	if len(queue) == 0 {
+		return nil
+	}
+	return slices.MinFunc(queue, func(a, b *globals.Process) int {
+		return cmp.Compare(key(a), key(b))
+	})
+}
+
+// nonPreemptive es la base de las políticas sin desalojo.
+type nonPreemptive struct{}
+
+func (nonPreemptive) Preemptive() bool { return false }
+
+func (nonPreemptive) ShouldPreempt(running *globals.Process, candidate *globals.Process) bool {
+	return false
+}
+
+func (nonPreemptive) OnBurstFinished(process *globals.Process, reason string) {
+	globals.UpdateBurstEstimation(process)
+}
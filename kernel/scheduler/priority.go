@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"log/slog"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/clock"
+	"ssoo-utils/pcb"
+	"time"
+)
+
+// PRIORITY: prioriza la menor prioridad efectiva (0 es la más alta).
+// Con priority_preemption un proceso más prioritario desaloja al de menor prioridad en EXEC.
+type priority struct{}
+
+func init() {
+	Register("PRIORITY", func() (SchedulingPolicy, error) { return priority{}, nil })
+}
+
+func (priority) PickNext(queue []*globals.Process) *globals.Process {
+	return pickMin(queue, func(p *globals.Process) int64 { return p.CurrentPriority.Load() })
+}
+
+func (priority) Preemptive() bool { return config.Values.PriorityPreemption }
+
+func (priority) ShouldPreempt(running *globals.Process, candidate *globals.Process) bool {
+	slog.Debug("Comparación entre proceso en EXEC y proceso con mayor prioridad en READY",
+		"prioridad en EXEC", running.CurrentPriority.Load(), "prioridad en READY", candidate.CurrentPriority.Load())
+	return candidate.CurrentPriority.Load() < running.CurrentPriority.Load()
+}
+
+// PickVictim elige el proceso en EXEC con menor prioridad.
+func (priority) PickVictim(running []*globals.Process, candidate *globals.Process) *globals.Process {
+	var victim *globals.Process
+	for _, process := range running {
+		if victim == nil || process.CurrentPriority.Load() > victim.CurrentPriority.Load() {
+			victim = process
+		}
+	}
+	return victim
+}
+
+func (priority) OnBurstFinished(process *globals.Process, reason string) {
+	globals.UpdateBurstEstimation(process)
+}
+
+// Run aplica aging: mejora la prioridad de los procesos que esperan en READY,
+// para que los de baja prioridad no sufran inanición.
+func (priority) Run() {
+	if config.Values.AgingInterval <= 0 {
+		return
+	}
+
+	clock.Hold() // el de la tarea, Sleep lo suelta mientras espera
+	for {
+		clock.Sleep(time.Duration(config.Values.AgingInterval) * time.Millisecond)
+		aged := false
+
+		globals.Processes.UpdateState(pcb.READY, func(queue []*globals.Process) {
+			for _, process := range queue {
+				if process.CurrentPriority.Load() > 0 {
+					current := process.CurrentPriority.Add(-1)
+					aged = true
+					slog.Debug("Aging - Mejora la prioridad del proceso", "pid", process.PCB.GetPID(), "prioridad", current)
+				}
+			}
+		})
+
+		if aged && config.Values.PriorityPreemption {
+			globals.UnlockSTS()
+		}
+	}
+}
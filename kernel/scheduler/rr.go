@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-kernel/queues"
+	"ssoo-utils/pcb"
+)
+
+// RR: FIFO con desalojo por fin de quantum.
+type roundRobin struct{ fifo }
+
+// VRR: además, los procesos que vuelven de IO con quantum sin consumir pasan por
+// la cola auxiliar de READY, que tiene prioridad, y solo reciben lo que les quedó.
+type virtualRoundRobin struct{ roundRobin }
+
+// Cola auxiliar de READY para VRR.
+const auxReadyQueue = "READY_AUX"
+
+func init() {
+	Register("RR", func() (SchedulingPolicy, error) {
+		if err := validateQuantum(); err != nil {
+			return nil, err
+		}
+		return roundRobin{}, nil
+	})
+	Register("VRR", func() (SchedulingPolicy, error) {
+		if err := validateQuantum(); err != nil {
+			return nil, err
+		}
+		return virtualRoundRobin{}, nil
+	})
+}
+
+func validateQuantum() error {
+	if config.Values.Quantum <= 0 {
+		return errors.New("quantum debe ser mayor a 0")
+	}
+	return nil
+}
+
+func (roundRobin) Quantum(process *globals.Process) int64 {
+	return config.Values.Quantum
+}
+
+func (virtualRoundRobin) Quantum(process *globals.Process) int64 {
+	if process.RemainingQuantum > 0 {
+		return process.RemainingQuantum
+	}
+	return config.Values.Quantum
+}
+
+func (virtualRoundRobin) ReadyQueues() []string { return []string{auxReadyQueue} }
+
+func (virtualRoundRobin) ReadyQueue(process *globals.Process) string {
+	if process.RemainingQuantum > 0 {
+		return auxReadyQueue
+	}
+	return pcb.READY.String()
+}
+
+// TakeReady prioriza la cola auxiliar. Quien sale de READY recibe el quantum completo.
+func (virtualRoundRobin) TakeReady(pick queues.PickFunc) *globals.Process {
+	if process := globals.Processes.Take(auxReadyQueue, pick); process != nil {
+		return process
+	}
+	process := queues.Dequeue(pcb.READY, pick)
+	if process != nil {
+		process.RemainingQuantum = 0
+	}
+	return process
+}
+
+func (virtualRoundRobin) Describe(queue string, process *globals.Process) string {
+	if queue != auxReadyQueue {
+		return ""
+	}
+	return fmt.Sprintf("PID:%d(Quantum:%d)", process.PCB.GetPID(), process.RemainingQuantum)
+}
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -12,6 +13,7 @@ import (
 	"ssoo-kernel/globals"
 	"ssoo-kernel/queues"
 	"ssoo-kernel/shared"
+	"ssoo-utils/clock"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
 	"ssoo-utils/pcb"
@@ -21,43 +23,41 @@ import (
 //#region LTS
 
 func LTS() {
-	<-globals.LTSStopped
-	var sortBy queues.SortBy
-
-	switch config.Values.ReadyIngressAlgorithm {
-	case "FIFO":
-		sortBy = queues.NoSort
-	case "PMCP":
-		sortBy = queues.Size
-	default:
-		panic("algoritmo de largo plazo inválido")
-	}
+	var waiter globals.Waiter
+	defer waiter.Close()
+	waiter.Wait(globals.LTSStopped)
 
 	for {
 		if !queues.IsEmpty(pcb.SUSP_READY) {
 			slog.Debug("Hay procesos en SUSP_READY, se bloquea LTS")
 			globals.UnlockMTS()
-			<-globals.RetryInitialization
+			waiter.Wait(globals.RetryInitialization)
 		}
 
-		var process = queues.Search(pcb.NEW, sortBy)
+		var process = queues.Search(pcb.NEW, ltsPolicy.PickNext)
 
 		if process == nil {
 			slog.Info("No hay procesos pendientes. Se bloquea LTS")
-			select {
-			case globals.STSEmpty <- struct{}{}:
+			if globals.Signal(globals.STSEmpty) {
 				slog.Debug("Se desbloquea STS porque hay nuevos procesos en READY")
-			default:
 			}
-			<-globals.LTSEmpty
+			waiter.Wait(globals.LTSEmpty)
 			continue
 		}
 
 		slog.Debug("Se encontró un proceso pendiente, inicializando...", "pid", process.PCB.GetPID())
-		if shared.TryInititializeProcess(process) {
+		err := shared.TryInititializeProcess(process)
+		switch {
+		case err == nil:
 			logger.RequiredLog(true, process.PCB.GetPID(), "Se crea el proceso", map[string]string{"Estado": "NEW"})
-		} else {
-			<-globals.RetryInitialization
+		case errors.Is(err, shared.ErrNoMemory):
+			waiter.Wait(globals.RetryInitialization)
+		default:
+			// Reintentar no lo arregla y, al frente de NEW, frenaría a todos los que vienen atrás.
+			logger.RequiredLog(true, process.PCB.GetPID(), "Memoria no pudo cargar el proceso, se finaliza", map[string]string{"Error": err.Error()})
+			if err := shared.Terminate(process); err != nil {
+				slog.Error("No se pudo finalizar el proceso", "pid", process.PCB.GetPID(), "error", err)
+			}
 		}
 	}
 }
@@ -67,33 +67,25 @@ func LTS() {
 
 func STS() {
 	slog.Info("STS iniciado")
-
-	if shared.CPUsNotConnected() {
-		slog.Debug("No hay CPUs conectadas, esperando a que se conecte una")
-		<-globals.CpuAvailableSignal
-	}
-
-	var sortBy queues.SortBy
-
-	switch config.Values.SchedulerAlgorithm {
-	case "FIFO":
-		sortBy = queues.NoSort
-	case "SJF", "SRT":
-		sortBy = queues.EstimatedBurst
-	default:
-		panic("algoritmo de planificación de corto plazo inválido, se ordena matar al culpable.")
-	}
+	var waiter globals.Waiter
+	defer waiter.Close()
 
 	for {
+		if shared.CPUsNotConnected() {
+			slog.Debug("No hay CPUs conectadas, esperando a que se conecte una")
+			waiter.Wait(globals.CpuAvailableSignal)
+			continue
+		}
+
 		if shared.IsCPUAvailable() {
 
 			slog.Info("CPU disponible, asignando proceso")
 			cpu := shared.GetAvailableCPU()
-			process := queues.Dequeue(pcb.READY, sortBy)
+			process := queues.DequeueReady(cpu.ID, stsPolicy.PickNext)
 
 			if process == nil {
 				slog.Info("Se bloquea STS porque no hay procesos en READY")
-				<-globals.STSEmpty
+				waiter.Wait(globals.STSEmpty)
 				continue
 			}
 			slog.Info("Proceso encontrado en READY", "pid", process.PCB.GetPID())
@@ -106,30 +98,22 @@ func STS() {
 
 			slog.Info("Se analiza Interrupción de CPU")
 
-			process := queues.Search(pcb.READY, sortBy)
+			process := queues.Search(pcb.READY, stsPolicy.PickNext)
 
 			if process == nil {
 				slog.Info("Se bloquea STS porque no hay procesos en READY")
-				<-globals.STSEmpty
+				waiter.Wait(globals.STSEmpty)
 				continue
 			}
 
-			cpu := GetCPUWithLonguesBurst()
+			cpu := GetCPUToPreempt(process)
 
-			if cpu != nil && cpu.Process != nil {
-				slog.Debug("Comparación entre proceso con mayor burst restante en EXEC y proceso con menor burst estimado")
-				slog.Debug("Tiempo restante de rafaga: ", "restante", globals.TiempoRestanteDeRafaga(cpu.Process))
-				slog.Debug("Tiempo estimado de rafaga: ", "estimado", process.EstimatedBurst)
-			}
+			if cpu != nil {
 
-			interrupt := cpu != nil && cpu.Process != nil && globals.TiempoRestanteDeRafaga(cpu.Process) > process.EstimatedBurst
+				slog.Debug("Se interrumpirá el proceso en EXEC", "pid", cpu.Process.PCB.GetPID())
+				slog.Debug("Se enviará a ejecutar el proceso", "pid", process.PCB.GetPID())
 
-			if interrupt {
-
-				slog.Debug("Se interrumpirá el proceso en EXEC", "pid", cpu.Process.PCB.GetPID(), "tiempo restante de rafaga", globals.TiempoRestanteDeRafaga(cpu.Process))
-				slog.Debug("Se enviará interrupción al proceso", "pid", process.PCB.GetPID(), "tiempo estimado de rafaga", process.EstimatedBurst)
-
-				err := interruptCPU(cpu, cpu.Process.PCB.GetPID())
+				err := shared.InterruptCPU(cpu, cpu.Process.MemoryPID())
 
 				if err != nil {
 					slog.Error("Error al interrumpir proceso", "pid", cpu.Process.PCB.GetPID(), "error", err)
@@ -148,7 +132,7 @@ func STS() {
 
 		}
 		slog.Debug("No hay CPUs disponibles, esperando a que se libere una")
-		<-globals.CpuAvailableSignal
+		waiter.Wait(globals.CpuAvailableSignal)
 		slog.Debug("Se desbloquea STS porque hay CPUs disponibles")
 	}
 }
@@ -156,39 +140,35 @@ func STS() {
 //#endregion
 
 func ShouldTryInterrupt() bool {
-	return config.Values.SchedulerAlgorithm == "SRT"
+	return stsPolicy.Preemptive()
 }
 
-func GetCPUWithLonguesBurst() *globals.CPUConnection {
-	maxCPU := globals.AvailableCPUs[0]
+// GetCPUToPreempt devuelve la CPU cuyo proceso debe ser desalojado por candidate, o nil si ninguno.
+func GetCPUToPreempt(candidate *globals.Process) *globals.CPUConnection {
+	globals.AvCPUmu.Lock()
+	defer globals.AvCPUmu.Unlock()
+
+	running := make([]*globals.Process, 0, len(globals.AvailableCPUs))
 	for _, cpu := range globals.AvailableCPUs {
-		if cpu.Process != nil && globals.TiempoRestanteDeRafaga(cpu.Process) > globals.TiempoRestanteDeRafaga(maxCPU.Process) {
-			maxCPU = cpu
+		if cpu.Process != nil && stsPolicy.ShouldPreempt(cpu.Process, candidate) {
+			running = append(running, cpu.Process)
 		}
 	}
-	return maxCPU
-}
-
-func interruptCPU(cpu *globals.CPUConnection, pid uint) error {
-	url := httputils.BuildUrl(httputils.URLData{
-		Ip:       cpu.IP,
-		Port:     cpu.Port,
-		Endpoint: "interrupt",
-	})
 
-	resp, err := http.Post(url, "text/plain", bytes.NewReader([]byte(fmt.Sprint(pid))))
-	if err != nil {
-		logger.Instance.Error("Error enviando interrupción a CPU", "ip", cpu.IP, "port", cpu.Port, "pid", pid, "error", err)
-		return err
+	if len(running) == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Instance.Error("CPU respondió con error a la interrupción", "status", resp.StatusCode, "ip", cpu.IP, "port", cpu.Port, "pid", pid)
-		return fmt.Errorf("interrupción fallida: status code %d", resp.StatusCode)
+	victim := running[0]
+	if picker, ok := stsPolicy.(victimPicker); ok {
+		victim = picker.PickVictim(running, candidate)
 	}
 
-	logger.Instance.Info("Interrupción enviada correctamente", "ip", cpu.IP, "port", cpu.Port, "pid", pid)
+	for _, cpu := range globals.AvailableCPUs {
+		if cpu.Process == victim {
+			return cpu
+		}
+	}
 	return nil
 }
 
@@ -206,35 +186,49 @@ func sendToExecute(process *globals.Process, cpu *globals.CPUConnection) {
 			"CPU": cpu.ID,
 		},
 	)
-	for _, exec := range globals.ExecQueue {
+	for _, exec := range queues.List(pcb.EXEC) {
 		slog.Debug("Ejecutando proceso en CPU", "pid", exec.PCB.GetPID())
 	}
 
 	queues.Enqueue(pcb.EXEC, process)
+	process.PCB.SetStateDetail(cpu.ID)
 
+	if process.LastCPU != "" && process.LastCPU != cpu.ID {
+		process.Migrations++
+		globals.Migrations.Inc()
+		slog.Debug("El proceso migra de CPU", "pid", process.PCB.GetPID(), "from", process.LastCPU, "to", cpu.ID)
+	}
+	process.LastCPU = cpu.ID
+
+	// El trabajo del reloj del proceso en la CPU lo suelta la CPU cuando el proceso deja de ejecutar,
+	// o quien la interrumpe (ver shared.InterruptCPU).
+	clock.Hold()
 	globals.AvCPUmu.Lock()
 	cpu.Process = process
 	globals.AvCPUmu.Unlock()
 
+	process.CurrentPriority.Store(int64(process.Priority))
+
 	request := globals.CPURequest{
-		PID: process.PCB.GetPID(),
+		PID: process.MemoryPID(),
+		TID: process.TID,
 		PC:  process.PCB.GetPC(),
 	}
 
-	process.StartTime = time.Now()
+	process.StartTime = clock.Now()
+	globals.ContextSwitches.Inc()
 
 	err := sendToWork(*cpu, request)
 
 	if err != nil {
+		clock.Release()
 		slog.Debug(err.Error())
-		process := queues.RemoveByPID(process.PCB.GetState(), process.PCB.GetPID())
+		process := queues.Move(pcb.EXEC, pcb.READY, process.PCB.GetPID())
 
 		if process == nil {
 			return
 		}
 
-		queues.Enqueue(pcb.READY, process)
-
 		globals.AvCPUmu.Lock()
 		cpu.Process = nil
 		globals.AvCPUmu.Unlock()
@@ -242,6 +236,42 @@ func sendToExecute(process *globals.Process, cpu *globals.CPUConnection) {
 		slog.Error("Error al enviar el proceso a la CPU", "error", err)
 		return
 	}
+
+	if policy, ok := stsPolicy.(timeSharing); ok {
+		startQuantumTimer(process, cpu, policy.Quantum(process))
+	}
+}
+
+func startQuantumTimer(process *globals.Process, cpu *globals.CPUConnection, quantum int64) {
+	globals.QuantumMutex.Lock()
+	process.Quantum = quantum
+	process.RemainingQuantum = 0
+	cancel := make(chan struct{})
+	process.QuantumCancel = cancel
+	globals.QuantumMutex.Unlock()
+
+	timer := clock.NewTimer(time.Duration(quantum) * time.Millisecond)
+	go func() {
+		defer timer.Done()
+		select {
+		case <-timer.C:
+		case <-cancel:
+			return
+		}
+
+		globals.QuantumMutex.Lock()
+		expired := process.QuantumCancel == cancel && cpu.Process == process && process.PCB.GetState() == pcb.EXEC
+		globals.QuantumMutex.Unlock()
+
+		if !expired {
+			return
+		}
+
+		slog.Info("Fin de quantum, se desaloja el proceso", "pid", process.PCB.GetPID(), "quantum", process.Quantum, "cpu", cpu.ID)
+		if err := shared.InterruptCPU(cpu, process.MemoryPID()); err != nil {
+			slog.Error("Error al interrumpir proceso por fin de quantum", "pid", process.PCB.GetPID(), "error", err)
+		}
+	}()
 }
 
 func sendToWork(cpu globals.CPUConnection, request globals.CPURequest) error {
@@ -280,30 +310,22 @@ func sendToWork(cpu globals.CPUConnection, request globals.CPURequest) error {
 
 func MTS() {
 
-	var sortBy queues.SortBy
 	var noMemory = false
-
-	switch config.Values.ReadyIngressAlgorithm {
-	case "FIFO":
-		sortBy = queues.NoSort
-	case "PMCP":
-		sortBy = queues.Size
-	default:
-		panic("algoritmo de largo plazo inválido")
-	}
+	var waiter globals.Waiter
 
 	for {
 
-		for _, blocked := range globals.MTSQueue {
-			shouldInitTimer := !blocked.Process.TimerRunning && blocked.Process.PCB.GetState() == pcb.BLOCKED && !blocked.DUMP_MEMORY
+		for _, blocked := range globals.BlockedList() {
+			// Los pedidos que mueven datos leen y escriben la memoria del proceso, no se suspende mientras esperan.
+			shouldInitTimer := !blocked.Process.TimerRunning && blocked.Process.PCB.GetState() == pcb.BLOCKED && !blocked.DUMP_MEMORY && blocked.Op == ""
 			if shouldInitTimer {
 				blocked.Process.TimerRunning = true
-				go sendToWait(blocked)
+				sendToWait(blocked)
 			}
 		}
 
 		for {
-			process := queues.Dequeue(pcb.SUSP_READY, sortBy)
+			process := queues.Dequeue(pcb.SUSP_READY, ltsPolicy.PickNext)
 
 			if process == nil {
 				slog.Info("No hay procesos pendientes en SUSP_READY. Se bloquea MTS")
@@ -321,32 +343,38 @@ func MTS() {
 			}
 		}
 
-		if !noMemory {
-			select {
-			case globals.RetryInitialization <- struct{}{}:
-				slog.Debug("Se intenta inicializar un proceso en NEW bloqueado por falta de memoria")
-			case globals.LTSEmpty <- struct{}{}:
-				slog.Debug("Se desbloquea LTS porque no hay procesos en SUSP_READY")
-			default:
-			}
-
+		// Los MALLOC bloqueados van antes que los procesos en NEW, igual que SUSP_READY.
+		if !noMemory && shared.RetryMallocs() {
+			globals.UnlockLTS()
 		} else {
 			noMemory = false
 		}
 
-		<-globals.MTSEmpty
+		waiter.Wait(globals.MTSEmpty)
 	}
 }
 
 //#endregion
 
+// sendToWait inicia el timer de suspensión del proceso bloqueado, si vence antes de que termine su IO se pasa a swap.
 func sendToWait(blocked *globals.Blocked) {
 	slog.Debug("Se inicia el timer para el proceso bloqueado por IO", "pid", blocked.Process.PCB.GetPID(), "IOName", blocked.Name)
 
-	timer := time.After(time.Duration(config.Values.SuspensionTime) * time.Millisecond)
-	process := blocked.Process
+	timer := clock.NewTimer(time.Duration(config.Values.SuspensionTime) * time.Millisecond)
+	go func() {
+		defer timer.Done()
+		select {
+		case <-timer.C:
+		case <-blocked.CancelTimer:
+			slog.Debug("Se cancela el timer de suspensión", "pid", blocked.Process.PCB.GetPID())
+			return
+		}
+		suspend(blocked)
+	}()
+}
 
-	<-timer
+func suspend(blocked *globals.Blocked) {
+	process := blocked.Process
 
 	globals.UnsuspendMutex.Lock()
 	defer globals.UnsuspendMutex.Unlock()
@@ -354,15 +382,20 @@ func sendToWait(blocked *globals.Blocked) {
 		slog.Debug("El proceso ya no está bloqueado", "pid", blocked.Process.PCB.GetPID(), "IOName", blocked.Name)
 		return
 	}
+	if len(process.LiveThreads()) > 1 {
+		// La memoria es de todo el proceso, no se suspende mientras otros hilos la usan.
+		slog.Debug("No se suspende el hilo, el proceso tiene otros hilos vivos", "pid", process.PCB.GetPID(), "tid", process.TID)
+		process.TimerRunning = false
+		return
+	}
 	slog.Info("Tiempo de espera para IO agotado. Se mueve de memoria principal a swap", "pid", blocked.Process.PCB.GetPID(), "IOName", blocked.Name)
 
-	process = queues.RemoveByPID(pcb.BLOCKED, process.PCB.GetPID())
+	process = queues.Move(pcb.BLOCKED, pcb.SUSP_BLOCKED, process.PCB.GetPID())
 
 	if process == nil {
 		return
 	}
-
-	queues.Enqueue(pcb.SUSP_BLOCKED, process)
+	process.PCB.SetStateDetail(blocked.Name)
 
 	blocked.Process.TimerRunning = false
 
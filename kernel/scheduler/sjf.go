@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"fmt"
+	"log/slog"
+	"ssoo-kernel/globals"
+)
+
+// SJF: prioriza la menor ráfaga estimada. Con desalojo es SRT.
+type sjf struct {
+	preemptive bool
+}
+
+func init() {
+	Register("SJF", func() (SchedulingPolicy, error) { return sjf{preemptive: false}, nil })
+	Register("SRT", func() (SchedulingPolicy, error) { return sjf{preemptive: true}, nil })
+}
+
+func (sjf) PickNext(queue []*globals.Process) *globals.Process {
+	return pickMin(queue, func(p *globals.Process) int64 { return p.EstimatedBurst })
+}
+
+func (policy sjf) Preemptive() bool { return policy.preemptive }
+
+func (policy sjf) ShouldPreempt(running *globals.Process, candidate *globals.Process) bool {
+	if !policy.preemptive {
+		return false
+	}
+	slog.Debug("Comparación entre proceso en EXEC y proceso con menor burst estimado",
+		"restante", globals.TiempoRestanteDeRafaga(running), "estimado", candidate.EstimatedBurst)
+	return globals.TiempoRestanteDeRafaga(running) > candidate.EstimatedBurst
+}
+
+// PickVictim elige el proceso en EXEC con mayor ráfaga restante.
+func (sjf) PickVictim(running []*globals.Process, candidate *globals.Process) *globals.Process {
+	return globals.MayorTiempoRestanteDeRafaga(running)
+}
+
+func (sjf) OnBurstFinished(process *globals.Process, reason string) {
+	previousEstimate := process.EstimatedBurst
+	globals.UpdateBurstEstimation(process)
+
+	slog.Info(fmt.Sprintf("PID %d - Burst real: %dms - Estimada previa: %dms - Nueva estimación: %dms",
+		process.PCB.GetPID(), process.LastRealBurst, previousEstimate, process.EstimatedBurst))
+}
@@ -1,7 +1,13 @@
 package shared
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
 	"ssoo-kernel/globals"
+	"ssoo-utils/clock"
+	"ssoo-utils/httputils"
+	"ssoo-utils/logger"
 )
 
 func CPUsNotConnected() bool {
@@ -18,17 +24,15 @@ func IsCPUAvailable() bool {
 }
 
 func FreeCPU(process *globals.Process) {
+	globals.StopQuantumTimer(process)
+
 	for _, cpu := range globals.AvailableCPUs {
 		if cpu.Process == process {
 			globals.AvCPUmu.Lock()
 			cpu.Process = nil
 			globals.AvCPUmu.Unlock()
 
-			select {
-			case globals.CpuAvailableSignal <- struct{}{}: //Just send signal...
-			default:
-				break
-			}
+			globals.Signal(globals.CpuAvailableSignal)
 		}
 	}
 }
@@ -41,3 +45,43 @@ func GetAvailableCPU() *globals.CPUConnection {
 	}
 	return nil
 }
+
+func GetCPUByProcess(process *globals.Process) *globals.CPUConnection {
+	for _, cpu := range globals.AvailableCPUs {
+		if cpu.Process == process {
+			return cpu
+		}
+	}
+	return nil
+}
+
+// InterruptCPU pide a la CPU que desaloje al proceso pid.
+// La CPU devuelve el proceso (ver kernel_api.HandleReason) antes de responder.
+//
+// Quien llama tiene que tener un trabajo del reloj. Lo suelta mientras la CPU termina la instrucción en curso,
+// que puede dormir, y si la interrupción se atendió se queda con el del proceso desalojado (ver sendToExecute).
+func InterruptCPU(cpu *globals.CPUConnection, pid uint) error {
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       cpu.IP,
+		Port:     cpu.Port,
+		Endpoint: "interrupt",
+	})
+
+	clock.Release()
+	resp, err := http.Post(url, "text/plain", bytes.NewReader([]byte(fmt.Sprint(pid))))
+	if err != nil {
+		clock.Hold()
+		logger.Instance.Error("Error enviando interrupción a CPU", "ip", cpu.IP, "port", cpu.Port, "pid", pid, "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		clock.Hold()
+		logger.Instance.Error("CPU respondió con error a la interrupción", "status", resp.StatusCode, "ip", cpu.IP, "port", cpu.Port, "pid", pid)
+		return fmt.Errorf("interrupción fallida: status code %d", resp.StatusCode)
+	}
+
+	logger.Instance.Info("Interrupción enviada correctamente", "ip", cpu.IP, "port", cpu.Port, "pid", pid)
+	return nil
+}
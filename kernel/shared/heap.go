@@ -0,0 +1,164 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/codeutils"
+	"ssoo-utils/httputils"
+	"ssoo-utils/logger"
+	"ssoo-utils/memoryutils"
+	"strconv"
+	"sync"
+)
+
+/*
+Memoria dinámica para la syscall MALLOC.
+
+Memoria agrega las páginas al final del espacio de direcciones del proceso, así que la dirección
+de la memoria nueva es el tamaño que tenía el proceso. Si memoria no tiene marcos libres el hilo queda
+en BLOCKED hasta que se libere memoria (fin o suspensión de un proceso, SHM_DETACH) y el MTS
+reintenta los pedidos pendientes en orden de llegada, antes de dejar inicializar procesos en NEW.
+
+Si el programa pasó un destino, la dirección asignada se escribe ahí (ver codeutils.ResultSize) antes de que vuelva a ejecutar.
+*/
+
+// ErrNoMemory indica que memoria rechazó el pedido por falta de marcos (código 507), se puede reintentar.
+var ErrNoMemory = errors.New("memoria sin marcos libres")
+
+type mallocRequest struct {
+	process     *globals.Process
+	size        int
+	destination int // -1 si el programa no pidió la dirección
+}
+
+var (
+	mallocMutex    sync.Mutex
+	pendingMallocs []mallocRequest
+)
+
+/*
+Malloc pide size bytes de memoria dinámica para el proceso y devuelve la dirección lógica que le asignó memoria.
+La dirección se escribe también en destination, salvo que sea -1.
+
+Si no hay memoria, o ya hay pedidos esperando, el pedido se encola y se llama a block antes de soltar el lock,
+así RetryMallocs siempre encuentra al hilo ya en BLOCKED.
+*/
+func Malloc(process *globals.Process, size int, destination int, block func()) (address string, blocked bool, err error) {
+	mallocMutex.Lock()
+	defer mallocMutex.Unlock()
+
+	request := mallocRequest{process, size, destination}
+	if len(pendingMallocs) == 0 {
+		address, err = request.try()
+		if !errors.Is(err, ErrNoMemory) {
+			return address, false, err
+		}
+	}
+
+	pendingMallocs = append(pendingMallocs, request)
+	slog.Debug("MALLOC - Sin memoria, se bloquea", "pid", process.PCB.GetPID(), "size", size, "esperando", len(pendingMallocs))
+	block()
+	return "", true, nil
+}
+
+// RetryMallocs reintenta en orden los pedidos pendientes y despierta a los hilos que consiguieron memoria.
+// Devuelve true si no quedó ningún pedido esperando.
+func RetryMallocs() bool {
+	mallocMutex.Lock()
+	failed := make([]*globals.Process, 0)
+	for len(pendingMallocs) > 0 {
+		request := pendingMallocs[0]
+		address, err := request.try()
+		if errors.Is(err, ErrNoMemory) {
+			break
+		}
+		pendingMallocs = pendingMallocs[1:]
+
+		if err != nil {
+			logger.RequiredLog(true, request.process.PCB.GetPID(), "Error en MALLOC, se finaliza el proceso", map[string]string{
+				"Error": err.Error(),
+			})
+			failed = append(failed, request.process)
+			continue
+		}
+		logger.RequiredLog(true, request.process.PCB.GetPID(), "Memoria dinámica asignada", map[string]string{
+			"Dir.Lógica": address,
+		})
+		Wake(request.process)
+	}
+	done := len(pendingMallocs) == 0
+	mallocMutex.Unlock()
+
+	for _, process := range failed {
+		if err := Terminate(process); err != nil {
+			slog.Error("No se pudo finalizar el proceso", "pid", process.PCB.GetPID(), "error", err)
+		}
+	}
+	return done
+}
+
+// removeMalloc descarta el pedido pendiente del hilo que termina.
+func removeMalloc(process *globals.Process) {
+	mallocMutex.Lock()
+	defer mallocMutex.Unlock()
+	pendingMallocs = slices.DeleteFunc(pendingMallocs, func(request mallocRequest) bool { return request.process == process })
+}
+
+// try pide la memoria y, si el programa pasó un destino, le escribe la dirección asignada.
+func (request mallocRequest) try() (string, error) {
+	address, err := requestMalloc(request.process, request.size)
+	if err != nil || request.destination < 0 {
+		return address, err
+	}
+	return address, WriteResult(request.process, request.destination, address)
+}
+
+// WriteResult escribe en destination la dirección que devuelve una syscall, con el formato de codeutils.FormatResult.
+func WriteResult(process *globals.Process, destination int, address string) error {
+	value, err := strconv.Atoi(address)
+	if err != nil {
+		return fmt.Errorf("dirección inválida de memoria: %q", address)
+	}
+	client := memoryutils.Client{Ip: config.Values.IpMemory, Port: config.Values.PortMemory}
+	if err := client.Write(process.MemoryPID(), destination, codeutils.FormatResult(value)); err != nil {
+		return fmt.Errorf("no se pudo escribir la dirección en %d: %w", destination, err)
+	}
+	return nil
+}
+
+func requestMalloc(process *globals.Process, size int) (string, error) {
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       config.Values.IpMemory,
+		Port:     config.Values.PortMemory,
+		Endpoint: "malloc",
+		Queries: map[string]string{
+			"pid":  fmt.Sprint(process.MemoryPID()),
+			"size": fmt.Sprint(size),
+		},
+	})
+
+	resp, err := http.Post(url, "text/plain", nil)
+	if err != nil {
+		return "", fmt.Errorf("error al llamar a Memoria: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return string(body), nil
+	case http.StatusInsufficientStorage:
+		return "", ErrNoMemory
+	default:
+		return "", fmt.Errorf("memoria rechazó el pedido (código %d): %s", resp.StatusCode, body)
+	}
+}
@@ -1,34 +1,66 @@
 package shared
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"ssoo-kernel/config"
+	"ssoo-kernel/devices"
 	"ssoo-kernel/globals"
+	"ssoo-kernel/messages"
 	"ssoo-kernel/queues"
+	"ssoo-kernel/resources"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
 	"ssoo-utils/pcb"
 	"strconv"
 )
 
-func CreateProcess(path string, size int) {
-	process := newProcess(path, size)
-	globals.TotalProcessesCreated++
+// CreateProcess crea un proceso hijo de parent, nil si lo crea el kernel.
+func CreateProcess(parent *globals.Process, path string, size int, priority int) uint {
+	process := newProcess(path, size, priority)
+	globals.TotalProcessesCreated.Add(1)
 
-	logger.RequiredLog(true, process.PCB.GetPID(), "Se crea el proceso",
+	variables := map[string]string{
+		"Estado":    "NEW",
+		"Path":      path,
+		"Size":      fmt.Sprintf("%d bytes", size),
+		"Prioridad": fmt.Sprint(priority),
+	}
+	if parent != nil {
+		addChild(parent, process)
+		variables["Padre"] = fmt.Sprint(parent.MemoryPID())
+	}
+	logger.RequiredLog(true, process.PCB.GetPID(), "Se crea el proceso", variables)
+
+	HandleNewProcess(process)
+	return process.PCB.GetPID()
+}
+
+// CreateThread crea un hilo secundario del proceso de owner que ejecuta el código de path.
+// No reserva memoria, usa las páginas del proceso. Devuelve el TID asignado.
+func CreateThread(owner *globals.Process, path string, priority int) uint {
+	thread := newProcess(path, 0, priority)
+	globals.AddThread(owner, thread)
+	globals.TotalProcessesCreated.Add(1)
+
+	logger.RequiredLog(true, thread.MemoryPID(), "Se crea el hilo",
 		map[string]string{
-			"Estado": "NEW",
-			"Path":   path,
-			"Size":   fmt.Sprintf("%d bytes", size),
+			"TID":       fmt.Sprint(thread.TID),
+			"PID Hilo":  fmt.Sprint(thread.PCB.GetPID()),
+			"Path":      path,
+			"Prioridad": fmt.Sprint(priority),
 		})
 
-	HandleNewProcess(process)
+	HandleNewProcess(thread)
+	return thread.TID
 }
 
-func newProcess(path string, size int) *globals.Process {
+func newProcess(path string, size int, priority int) *globals.Process {
 	process := new(globals.Process)
 	process.PCB = pcb.Create(getNextPID(), path)
 	process.Path = path
@@ -36,102 +68,191 @@ func newProcess(path string, size int) *globals.Process {
 	process.LastRealBurst = 0
 	process.EstimatedBurst = config.Values.InitialEstimate
 	process.TimerRunning = false
+	process.Priority = priority
+	process.CurrentPriority.Store(int64(priority))
 	return process
 }
 
-func sendToInitializeInMemory(pid uint, codePath string, size int) error {
+func sendToInitializeInMemory(process *globals.Process) error {
 	url := httputils.BuildUrl(httputils.URLData{
 		Ip:       config.Values.IpMemory,
 		Port:     config.Values.PortMemory,
 		Endpoint: "process",
 		Queries: map[string]string{
-			"pid":  fmt.Sprint(pid),
-			"size": fmt.Sprint(size),
+			"pid":  fmt.Sprint(process.PCB.GetPID()),
+			"size": fmt.Sprint(process.Size),
 		},
 	})
+	if process.IsThread() {
+		// El hilo solo carga su código, la memoria es la del proceso.
+		url = httputils.BuildUrl(httputils.URLData{
+			Ip:       config.Values.IpMemory,
+			Port:     config.Values.PortMemory,
+			Endpoint: "thread",
+			Queries: map[string]string{
+				"pid": fmt.Sprint(process.MemoryPID()),
+				"tid": fmt.Sprint(process.TID),
+			},
+		})
+	}
+	codePath := process.GetPath()
 
 	codeFile, err := os.OpenFile(codePath, os.O_RDONLY, 0666)
 	if err != nil {
 		return fmt.Errorf("error al abrir el archivo de código: %v", err)
 	}
 
+	defer codeFile.Close()
+
 	resp, err := http.Post(url, "text/plain", codeFile)
 	if err != nil {
 		return fmt.Errorf("error al llamar a Memoria: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("memoria rechazó la creación (código %d)", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusInsufficientStorage:
+		return ErrNoMemory
 	}
-
-	return nil
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("memoria rechazó la creación (código %d): %s", resp.StatusCode, body)
 }
 
-func TryInititializeProcess(process *globals.Process) bool {
-	err := sendToInitializeInMemory(process.PCB.GetPID(), process.GetPath(), process.Size)
+/*
+TryInititializeProcess carga al proceso en memoria y lo pasa de NEW a READY.
+
+Devuelve ErrNoMemory si memoria no tiene lugar, el proceso sigue en NEW hasta que se libere memoria.
+Cualquier otro error (ej. un programa que memoria no puede interpretar) no se arregla reintentando.
+*/
+func TryInititializeProcess(process *globals.Process) error {
+	err := sendToInitializeInMemory(process)
 	if err != nil {
-		return false
+		return err
 	}
 
-	queues.RemoveByPID(pcb.NEW, process.PCB.GetPID())
-	queues.Enqueue(pcb.READY, process)
-
-	select {
-	case globals.STSEmpty <- struct{}{}:
-	default:
+	if queues.Move(pcb.NEW, pcb.READY, process.PCB.GetPID()) == nil {
+		// Se finalizó mientras se cargaba. TerminateProcess no lo borró de memoria porque nunca llegó a READY.
+		slog.Info("El proceso se finalizó mientras se inicializaba, se elimina de memoria", "pid", process.PCB.GetPID())
+		if !process.IsThread() {
+			if err := deleteFromMemory(process); err != nil {
+				logger.RequiredLog(true, process.PCB.GetPID(), "Error al eliminar el proceso de memoria", map[string]string{"Error": err.Error()})
+			}
+		}
+		return nil
 	}
+	process.InMemory = true
 
-	return true
+	globals.Signal(globals.STSEmpty)
+
+	return nil
 }
 
 func HandleNewProcess(process *globals.Process) {
 	queues.Enqueue(pcb.NEW, process)
 
-	select {
-	case globals.LTSEmpty <- struct{}{}:
+	if globals.Signal(globals.LTSEmpty) {
 		slog.Debug("se desbloquea LTS que estaba bloqueado por no haber procesos para planificar")
-	default:
 	}
 }
 
 func TerminateProcess(process *globals.Process) {
-	if len(globals.ExitQueue) == globals.TotalProcessesCreated {
+	if config.Values.Daemon {
+		defer queues.TrimExit(config.Values.ExitHistory)
+	} else if int64(globals.Processes.Len(pcb.EXIT)) == globals.TotalProcessesCreated.Load() {
 		defer globals.ClearAndExit()
 	}
 
 	pid := process.PCB.GetPID()
+
+	for _, woken := range resources.ReleaseAll(process) {
+		Wake(woken)
+	}
+	messages.Remove(process)
+	removeMalloc(process)
+	devices.Remove(process)
+	for _, joiner := range takeJoiners(process) {
+		Wake(joiner)
+	}
+
+	// La memoria es del proceso, se libera cuando termina su último hilo.
+	// Un proceso que nunca pasó por READY no llegó a inicializarse en memoria.
+	main := process.Main()
+	exited := len(process.LiveThreads()) == 0
+	if exited {
+		processExited(main)
+		removeUpload(main)
+	}
+	if exited && main.PCB.GetKernelMetrics().Frequency[pcb.READY] > 0 {
+		if err := deleteFromMemory(main); err != nil {
+			logger.RequiredLog(true, pid, "Error al eliminar el proceso de memoria", map[string]string{"Error": err.Error()})
+			return
+		}
+		main.InMemory = false
+	}
+	process.InMemory = false
+
+	logger.RequiredLog(true, pid, "", map[string]string{"Métricas de estado:": process.PCB.GetKernelMetrics().String()})
+	queues.MostrarLasColas("TerminateProcess")
+
+	if globals.Signal(globals.MTSEmpty) {
+		slog.Debug("Se libera memoria y hay procesos esperando para planificar. Se envia signal de desbloqueo de LTS")
+	} else {
+		slog.Debug("No hay procesos esperando para inicializarse, ni tampoco en Suspendido Ready.")
+	}
+}
+
+// deleteFromMemory elimina de memoria al proceso principal y libera sus marcos.
+func deleteFromMemory(main *globals.Process) error {
 	url := httputils.BuildUrl(httputils.URLData{
 		Ip:       config.Values.IpMemory,
 		Port:     config.Values.PortMemory,
 		Endpoint: "process",
 		Queries: map[string]string{
-			"pid": fmt.Sprint(pid),
+			"pid": fmt.Sprint(main.PCB.GetPID()),
 		},
 	})
 
 	req, _ := http.NewRequest(http.MethodDelete, url, nil)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		logger.RequiredLog(true, pid, "Error al eliminar el proceso de memoria", map[string]string{"Error": err.Error()})
-		return
+		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		logger.RequiredLog(true, pid, "Error al eliminar el proceso de memoria", map[string]string{"Código": fmt.Sprint(resp.StatusCode)})
-		return
+		return fmt.Errorf("código %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	defer resp.Body.Close()
+// UploadsFolder es la carpeta dentro de CodeFolder donde se guarda el pseudocódigo recibido por POST /process.
+const UploadsFolder = "uploads"
 
-	logger.RequiredLog(true, pid, "", map[string]string{"Métricas de estado:": process.PCB.GetKernelMetrics().String()})
-	queues.MostrarLasColas("TerminateProcess")
+// removeUpload borra el pseudocódigo subido por POST /process cuando termina el proceso que lo usaba.
+func removeUpload(process *globals.Process) {
+	if filepath.Dir(process.Path) != UploadsFolder {
+		return
+	}
+	if err := os.Remove(process.GetPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("No se pudo borrar el pseudocódigo subido", "pid", process.PCB.GetPID(), "path", process.Path, "error", err)
+	}
+}
 
-	select {
-	case globals.MTSEmpty <- struct{}{}:
-		slog.Debug("Se libera memoria y hay procesos esperando para planificar. Se envia signal de desbloqueo de LTS")
-	default:
-		slog.Debug("No hay procesos esperando para inicializarse, ni tampoco en Suspendido Ready.")
+// takeJoiners devuelve los hilos que esperaban en THREAD_JOIN a que termine process.
+func takeJoiners(process *globals.Process) []*globals.Process {
+	globals.ThreadsMutex.Lock()
+	defer globals.ThreadsMutex.Unlock()
+	joiners := process.Joiners
+	process.Joiners = nil
+	return joiners
+}
+
+// Wake pasa a READY a un proceso bloqueado esperando un recurso.
+func Wake(process *globals.Process) {
+	if queues.Move(pcb.BLOCKED, pcb.READY, process.PCB.GetPID()) != nil {
+		globals.UnlockSTS()
 	}
 }
 
@@ -152,7 +273,7 @@ func Unsuspend(process *globals.Process) bool {
 		Port:     config.Values.PortMemory,
 		Endpoint: "unsuspend",
 		Queries: map[string]string{
-			"pid": strconv.Itoa(int(process.PCB.GetPID())),
+			"pid": strconv.Itoa(int(process.MemoryPID())),
 		},
 	})
 
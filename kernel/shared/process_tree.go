@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/logger"
+)
+
+// Terminate finaliza un hilo en cualquier estado. Se define en main (ver kernel_api.Kill).
+var Terminate func(process *globals.Process) error = func(process *globals.Process) error {
+	return fmt.Errorf("no hay forma de finalizar procesos")
+}
+
+func ValidateOrphanPolicy() error {
+	switch config.Values.OrphanPolicy {
+	case "", globals.OrphanReparent, globals.OrphanCascade:
+		return nil
+	}
+	return fmt.Errorf("orphan_policy desconocida: %s", config.Values.OrphanPolicy)
+}
+
+// addChild registra a child como hijo del proceso de parent.
+func addChild(parent *globals.Process, child *globals.Process) {
+	globals.TreeMutex.Lock()
+	defer globals.TreeMutex.Unlock()
+	parent = parent.Main()
+	child.Parent = parent
+	parent.Children = append(parent.Children, child)
+}
+
+/*
+WaitChild bloquea al hilo hasta que termine el hijo pid de su proceso, o cualquier hijo si any.
+
+Si no tiene hijos vivos, o pid no es uno de ellos, no se bloquea y devuelve false.
+block se llama con TreeMutex tomado, así processExited siempre lo encuentra en BLOCKED al despertarlo.
+*/
+func WaitChild(thread *globals.Process, pid uint, any bool, block func()) bool {
+	globals.TreeMutex.Lock()
+	defer globals.TreeMutex.Unlock()
+
+	process := thread.Main()
+	waits := len(process.Children) > 0
+	if !any {
+		waits = slices.ContainsFunc(process.Children, func(child *globals.Process) bool { return child.PCB.GetPID() == pid })
+	}
+	if !waits {
+		slog.Debug("WAIT_CHILD - No hay hijo que esperar", "pid", process.PCB.GetPID(), "hijo", pid, "any", any)
+		return false
+	}
+
+	process.ChildWaiters = append(process.ChildWaiters, globals.ChildWaiter{Thread: thread, PID: pid, Any: any})
+	block()
+	return true
+}
+
+// processExited se llama cuando termina el último hilo del proceso: despierta al padre si lo esperaba
+// y aplica orphan_policy a sus hijos.
+func processExited(process *globals.Process) {
+	pid := process.PCB.GetPID()
+
+	globals.TreeMutex.Lock()
+	parent := process.Parent
+	woken := make([]*globals.Process, 0)
+	if parent != nil {
+		parent.Children = slices.DeleteFunc(parent.Children, func(child *globals.Process) bool { return child == process })
+		parent.ChildWaiters = slices.DeleteFunc(parent.ChildWaiters, func(waiter globals.ChildWaiter) bool {
+			if waiter.Any || waiter.PID == pid {
+				woken = append(woken, waiter.Thread)
+				return true
+			}
+			return false
+		})
+	}
+
+	orphans := process.Children
+	process.Children = nil
+	process.ChildWaiters = nil
+	cascade := config.Values.OrphanPolicy == globals.OrphanCascade
+	if !cascade {
+		for _, orphan := range orphans {
+			orphan.Parent = parent
+			if parent != nil {
+				parent.Children = append(parent.Children, orphan)
+			}
+		}
+	}
+	globals.TreeMutex.Unlock()
+
+	for _, waiter := range woken {
+		logger.RequiredLog(true, waiter.PCB.GetPID(), "Termina el hijo que esperaba", map[string]string{"Hijo": fmt.Sprint(pid)})
+		Wake(waiter)
+	}
+
+	for _, orphan := range orphans {
+		if !cascade {
+			newParent := "ninguno"
+			if parent != nil {
+				newParent = fmt.Sprint(parent.PCB.GetPID())
+			}
+			logger.RequiredLog(true, orphan.PCB.GetPID(), "Proceso huérfano, cambia de padre", map[string]string{
+				"Padre anterior": fmt.Sprint(pid),
+				"Padre nuevo":    newParent,
+			})
+			continue
+		}
+
+		logger.RequiredLog(true, orphan.PCB.GetPID(), "Proceso huérfano, se finaliza con su padre", map[string]string{
+			"Padre": fmt.Sprint(pid),
+		})
+		for _, thread := range orphan.LiveThreads() {
+			if err := Terminate(thread); err != nil {
+				slog.Error("No se pudo finalizar el proceso huérfano", "pid", thread.PCB.GetPID(), "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package timeline
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"ssoo-kernel/config"
+	"ssoo-kernel/globals"
+	"ssoo-utils/clock"
+	"ssoo-utils/pcb"
+	"time"
+)
+
+/*
+Línea de tiempo de la corrida armada a partir del historial de estados de cada PCB.
+
+Se puede consultar en vivo (ver kernel_api.Timeline) y se guarda al cerrar el kernel
+en timeline_folder como JSON y como diagrama de Gantt en HTML.
+*/
+
+type Segment struct {
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"` // CPU en EXEC, dispositivo en BLOCKED/SUSP_BLOCKED
+	Start  int64  `json:"start_ms"`
+	End    int64  `json:"end_ms"`
+}
+
+type Row struct {
+	PID      uint      `json:"pid"`
+	Path     string    `json:"path"`
+	Segments []Segment `json:"segments"`
+}
+
+type Timeline struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Scheduler string    `json:"scheduler_algorithm"`
+	Ingress   string    `json:"ready_ingress_algorithm"`
+	Processes []Row     `json:"processes"`
+}
+
+// Build arma la línea de tiempo de los procesos hasta el instante actual.
+func Build(processes []*globals.Process) Timeline {
+	end := clock.Now()
+	start := end
+	for _, process := range processes {
+		instants := process.PCB.GetKernelMetrics().Instants_list
+		if len(instants) > 0 && instants[0].Before(start) {
+			start = instants[0]
+		}
+	}
+
+	timeline := Timeline{
+		Start:     start,
+		End:       end,
+		Scheduler: config.Values.SchedulerAlgorithm,
+		Ingress:   config.Values.ReadyIngressAlgorithm,
+		Processes: make([]Row, 0, len(processes)),
+	}
+
+	for _, process := range processes {
+		metrics := process.PCB.GetKernelMetrics()
+		timeline.Processes = append(timeline.Processes, Row{
+			PID:      process.PCB.GetPID(),
+			Path:     process.Path,
+			Segments: segments(metrics.Sequence_list, metrics.Instants_list, metrics.Details_list, start, end),
+		})
+	}
+	slices.SortFunc(timeline.Processes, func(a, b Row) int { return cmp.Compare(a.PID, b.PID) })
+
+	return timeline
+}
+
+func segments(history []pcb.STATE, instants []time.Time, details []string, start time.Time, end time.Time) []Segment {
+	result := make([]Segment, 0, len(history))
+	for i, state := range history {
+		if state == pcb.EXIT {
+			continue
+		}
+
+		until := end
+		if i+1 < len(instants) {
+			until = instants[i+1]
+		}
+		segment := Segment{
+			State:  state.String(),
+			Detail: details[i],
+			Start:  instants[i].Sub(start).Milliseconds(),
+			End:    until.Sub(start).Milliseconds(),
+		}
+
+		// Se unen las transiciones que no cambian de estado (ej. NEW al crearse y al encolarse).
+		if last := len(result) - 1; last >= 0 && result[last].State == segment.State &&
+			result[last].Detail == segment.Detail && result[last].End == segment.Start {
+			result[last].End = segment.End
+			continue
+		}
+		result = append(result, segment)
+	}
+	return result
+}
+
+func (t Timeline) Duration() int64 { return t.End.Sub(t.Start).Milliseconds() }
+
+func (t Timeline) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// #region GANTT
+
+var stateColors = map[string]string{
+	pcb.NEW.String():          "#9e9e9e",
+	pcb.READY.String():        "#ffd54f",
+	pcb.EXEC.String():         "#66bb6a",
+	pcb.BLOCKED.String():      "#ef5350",
+	pcb.SUSP_READY.String():   "#ffb74d",
+	pcb.SUSP_BLOCKED.String(): "#ab47bc",
+}
+
+var legendOrder = []pcb.STATE{pcb.NEW, pcb.READY, pcb.EXEC, pcb.BLOCKED, pcb.SUSP_READY, pcb.SUSP_BLOCKED}
+
+const (
+	labelWidth = 140
+	chartWidth = 1000
+	rowHeight  = 26
+	barHeight  = 18
+	axisHeight = 30
+)
+
+// WriteHTML escribe un diagrama de Gantt autocontenido (HTML con SVG embebido).
+func (t Timeline) WriteHTML(w io.Writer) error {
+	duration := max(t.Duration(), 1)
+	scale := float64(chartWidth) / float64(duration)
+	height := axisHeight + rowHeight*len(t.Processes) + 20
+	x := func(ms int64) float64 { return labelWidth + float64(ms)*scale }
+
+	title := fmt.Sprintf("Planificación %s / %s - %s", t.Scheduler, t.Ingress, t.Start.Format(time.DateTime))
+
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprint(w, "<style>body{font-family:sans-serif}svg text{font-size:11px}.legend span{display:inline-block;padding:2px 8px;margin-right:6px}</style>\n")
+	fmt.Fprintf(w, "</head>\n<body>\n<h3>%s</h3>\n<div class=\"legend\">", html.EscapeString(title))
+	for _, state := range legendOrder {
+		fmt.Fprintf(w, "<span style=\"background:%s\">%s</span>", stateColors[state.String()], state.String())
+	}
+	fmt.Fprint(w, "</div>\n")
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n", labelWidth+chartWidth+20, height)
+
+	// Eje de tiempo
+	step := tickStep(duration)
+	for ms := int64(0); ms <= duration; ms += step {
+		fmt.Fprintf(w, "<line x1=\"%.1f\" y1=\"%d\" x2=\"%.1f\" y2=\"%d\" stroke=\"#ddd\"/>", x(ms), axisHeight-5, x(ms), height-20)
+		fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\">%dms</text>\n", x(ms), axisHeight-10, ms)
+	}
+
+	for i, row := range t.Processes {
+		y := axisHeight + i*rowHeight
+		label := fmt.Sprintf("PID %d (%s)", row.PID, row.Path)
+		fmt.Fprintf(w, "<text x=\"4\" y=\"%d\">%s</text>\n", y+barHeight-5, html.EscapeString(label))
+
+		for _, segment := range row.Segments {
+			width := max(float64(segment.End-segment.Start)*scale, 1)
+			text := segment.State
+			if segment.Detail != "" {
+				text += " " + segment.Detail
+			}
+			tooltip := fmt.Sprintf("PID %d - %s [%d, %d]ms", row.PID, text, segment.Start, segment.End)
+
+			fmt.Fprintf(w, "<g><title>%s</title><rect x=\"%.1f\" y=\"%d\" width=\"%.1f\" height=\"%d\" fill=\"%s\" stroke=\"#fff\"/>",
+				html.EscapeString(tooltip), x(segment.Start), y, width, barHeight, stateColors[segment.State])
+			if segment.Detail != "" && width > float64(len(segment.Detail)*7) {
+				fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%d\">%s</text>", x(segment.Start)+3, y+barHeight-5, html.EscapeString(segment.Detail))
+			}
+			fmt.Fprint(w, "</g>\n")
+		}
+	}
+
+	fmt.Fprint(w, "</svg>\n</body>\n</html>\n")
+	return nil
+}
+
+// tickStep elige un paso "redondo" (1, 2 o 5 por potencia de 10) para unas 10 marcas en el eje.
+func tickStep(duration int64) int64 {
+	step := int64(1)
+	for {
+		for _, m := range []int64{1, 2, 5} {
+			if duration/(step*m) <= 10 {
+				return step * m
+			}
+		}
+		step *= 10
+	}
+}
+
+// #endregion
+
+// Save guarda la línea de tiempo en folder como timeline_<fecha>.json y timeline_<fecha>.html.
+func Save(folder string, processes []*globals.Process) error {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+
+	timeline := Build(processes)
+	// Se usa la hora real, con el reloj virtual todas las corridas arrancan en clock.Epoch.
+	name := filepath.Join(folder, "timeline_"+time.Now().Format("20060102_150405"))
+
+	for extension, write := range map[string]func(io.Writer) error{
+		".json": timeline.WriteJSON,
+		".html": timeline.WriteHTML,
+	} {
+		file, err := os.Create(name + extension)
+		if err != nil {
+			return err
+		}
+		err = write(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log/slog"
 	"ssoo-utils/configManager"
+	"ssoo-utils/httputils"
 )
 
 type MemoryConfig struct {
@@ -16,6 +17,9 @@ type MemoryConfig struct {
 	SwapDelay      int        `json:"swap_delay"`
 	DumpPath       string     `json:"dump_path"`
 	LogLevel       slog.Level `json:"log_level"`
+	ClockMode      string     `json:"clock_mode"`
+	IpKernel       string     `json:"ip_kernel"`  // solo para el reloj virtual
+	PortKernel     int        `json:"port_kernel"` // solo para el reloj virtual
 }
 
 var Values MemoryConfig
@@ -32,6 +36,9 @@ func Load() {
 	if err != nil {
 		panic(err)
 	}
+	if Values.IpKernel == "self" {
+		Values.IpKernel = httputils.GetOutboundIP()
+	}
 	Values.DumpPath = configManager.GetDefaultExePath() + Values.DumpPath
 	Values.SwapfilePath = configManager.GetDefaultExePath() + Values.SwapfilePath
 }
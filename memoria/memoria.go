@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,8 +10,12 @@ import (
 	"os"
 	"ssoo-memoria/config"
 	"ssoo-memoria/storage"
+	"ssoo-utils/clock"
+	"ssoo-utils/codeutils"
 	"ssoo-utils/httputils"
 	"ssoo-utils/logger"
+	"ssoo-utils/memoryutils"
+	"ssoo-utils/metrics"
 	"ssoo-utils/parsers"
 	"strconv"
 	"time"
@@ -34,6 +39,12 @@ func main() {
 	log := logger.Instance
 	log.Info("Arranca Memoria")
 
+	err = clock.Setup(config.Values.ClockMode, fmt.Sprintf("%s:%d", config.Values.IpKernel, config.Values.PortKernel))
+	if err != nil {
+		fmt.Printf("Error configurando el reloj: %v\n", err)
+		return
+	}
+
 	// #endregion
 
 	// #region CREATE SERVER
@@ -43,14 +54,19 @@ func main() {
 
 	// Add routes to mux
 	mux.Handle("/process", processDataReqHandler.HandlerFunc())
+	mux.Handle("/thread", threadReqHandler.HandlerFunc())
 	mux.Handle("/frame", processFrameReqHandler.HandlerFunc())
 	mux.Handle("/user_memory", userMemoryReqHandler.HandlerFunc())
 	mux.Handle("/memory_dump", memoryDumpReqHandler.HandlerFunc())
 	mux.Handle("/full_page", fullPageReqHandler.HandlerFunc())
+	mux.Handle("/logical_memory", logicalMemoryReqHandler.HandlerFunc())
+	mux.Handle("/shared_memory", sharedMemoryReqHandler.HandlerFunc())
+	mux.Handle("/malloc", mallocReqHandler.HandlerFunc())
 	mux.Handle("/memory_config", memoryConfigReqHandler.HandlerFunc())
 	mux.Handle("/suspend", suspendProcessRequestHandler.HandlerFunc())
 	mux.Handle("/unsuspend", unsuspendProcessRequestHandler.HandlerFunc())
 	mux.Handle("/free_space", freeSpaceRequestHandler.HandlerFunc())
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTeapot)
 		go func() {
@@ -130,9 +146,10 @@ var processDataReqHandler = GenericRequest{
 	"GET": MethodRequestInfo{
 		ReqParams: []string{"pid", "pc"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			instruction, err := storage.GetInstruction(
 				uint(numFromQuery(r, "pid")),
+				uint(numFromQuery(r, "tid")),
 				numFromQuery(r, "pc"),
 			)
 			if err != nil {
@@ -148,14 +165,14 @@ var processDataReqHandler = GenericRequest{
 	"POST": MethodRequestInfo{
 		ReqParams: []string{"pid", "size"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			err := storage.CreateProcess(
 				uint(numFromQuery(r, "pid")),
 				r.Body,
 				numFromQuery(r, "size"),
 			)
 			if err != nil {
-				return SimpleResponse{http.StatusBadGateway, []byte(err.Error())}
+				return loadErrorResponse(err)
 			}
 			return SimpleResponse{http.StatusOK, []byte{}}
 		},
@@ -163,7 +180,7 @@ var processDataReqHandler = GenericRequest{
 	"DELETE": MethodRequestInfo{
 		ReqParams: []string{"pid"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			err := storage.DeleteProcess(uint(numFromQuery(r, "pid")))
 			if err != nil {
 				return SimpleResponse{http.StatusBadGateway, []byte(err.Error())}
@@ -173,6 +190,36 @@ var processDataReqHandler = GenericRequest{
 	},
 }
 
+var threadReqHandler = GenericRequest{
+	"POST": MethodRequestInfo{
+		ReqParams: []string{"pid", "tid"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			err := storage.CreateThread(
+				uint(numFromQuery(r, "pid")),
+				uint(numFromQuery(r, "tid")),
+				r.Body,
+			)
+			if err != nil {
+				return loadErrorResponse(err)
+			}
+			return SimpleResponse{http.StatusOK, []byte{}}
+		},
+	},
+}
+
+// loadErrorResponse distingue por qué no se pudo cargar un proceso o hilo: con 507 el kernel
+// puede reintentar cuando se libere memoria, con 400 el programa nunca va a poder cargarse.
+func loadErrorResponse(err error) SimpleResponse {
+	switch {
+	case errors.Is(err, storage.ErrNotEnoughMemory):
+		return SimpleResponse{http.StatusInsufficientStorage, []byte(err.Error())}
+	case errors.Is(err, codeutils.ErrInvalidCode):
+		return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+	}
+	return SimpleResponse{http.StatusBadGateway, []byte(err.Error())}
+}
+
 var processFrameReqHandler = GenericRequest{
 	"GET": MethodRequestInfo{
 		ReqParams: []string{"pid", "address"},
@@ -185,6 +232,9 @@ var processFrameReqHandler = GenericRequest{
 			if err != nil {
 				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
 			}
+			if storage.IsSharedFrame(uint(numFromQuery(r, "pid")), frameBase) {
+				w.Header().Set(memoryutils.SharedHeader, "true")
+			}
 			return SimpleResponse{http.StatusOK, []byte(fmt.Sprint(frameBase))}
 		},
 	},
@@ -194,7 +244,7 @@ var userMemoryReqHandler = GenericRequest{
 	"GET": MethodRequestInfo{
 		ReqParams: []string{"pid", "base", "delta"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			pid, base, delta := uint(numFromQuery(r, "pid")), numFromQuery(r, "base"), numFromQuery(r, "delta")
 			result, err := storage.GetFromMemory(pid, base, delta)
 			if err != nil {
@@ -210,7 +260,7 @@ var userMemoryReqHandler = GenericRequest{
 	"POST": MethodRequestInfo{
 		ReqParams: []string{"pid", "base", "delta"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			pid, base, delta := uint(numFromQuery(r, "pid")), numFromQuery(r, "base"), numFromQuery(r, "delta")
 			value, _ := io.ReadAll(r.Body)
 			err := storage.WriteToMemory(pid, base, delta, value[0])
@@ -230,7 +280,7 @@ var memoryDumpReqHandler = GenericRequest{
 	"ANY": MethodRequestInfo{
 		ReqParams: []string{"pid"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 			err := storage.Memory_Dump(uint(numFromQuery(r, "pid")))
 			if err != nil {
 				return SimpleResponse{http.StatusBadGateway, []byte(err.Error())}
@@ -256,7 +306,7 @@ var fullPageReqHandler = GenericRequest{
 	"GET": MethodRequestInfo{
 		ReqParams: []string{"pid", "base"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay*config.Values.PageSize) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay*config.Values.PageSize) * time.Millisecond)
 			pid, base := uint(numFromQuery(r, "pid")), numFromQuery(r, "base")
 			if ok, err := storage.HasPage(pid, base); !ok {
 				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
@@ -275,7 +325,7 @@ var fullPageReqHandler = GenericRequest{
 	"POST": MethodRequestInfo{
 		ReqParams: []string{"pid", "base"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.MemoryDelay*config.Values.PageSize) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.MemoryDelay*config.Values.PageSize) * time.Millisecond)
 			pid, base := uint(numFromQuery(r, "pid")), numFromQuery(r, "base")
 			value, _ := io.ReadAll(r.Body)
 			err := storage.WritePage(pid, base, value)
@@ -291,6 +341,90 @@ var fullPageReqHandler = GenericRequest{
 	},
 }
 
+// El kernel lee y escribe un rango de direcciones lógicas de un proceso (ej. para MSG_SEND y MSG_RECV).
+var logicalMemoryReqHandler = GenericRequest{
+	"GET": MethodRequestInfo{
+		ReqParams: []string{"pid", "address", "size"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			pid, address, size := uint(numFromQuery(r, "pid")), numFromQuery(r, "address"), numFromQuery(r, "size")
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			data, err := storage.ReadLogical(pid, address, size)
+			if err != nil {
+				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+			}
+			logger.RequiredLog(true, pid, "Lectura", map[string]string{
+				"Dir.Lógica": fmt.Sprint(address),
+				"Tamaño":     fmt.Sprint(size),
+			})
+			return SimpleResponse{http.StatusOK, data}
+		},
+	},
+	"POST": MethodRequestInfo{
+		ReqParams: []string{"pid", "address"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			pid, address := uint(numFromQuery(r, "pid")), numFromQuery(r, "address")
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			value, _ := io.ReadAll(r.Body)
+			err := storage.WriteLogical(pid, address, value)
+			if err != nil {
+				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+			}
+			logger.RequiredLog(true, pid, "Escritura", map[string]string{
+				"Dir.Lógica": fmt.Sprint(address),
+				"Tamaño":     fmt.Sprint(len(value)),
+			})
+			return SimpleResponse{http.StatusOK, []byte{}}
+		},
+	},
+}
+
+var sharedMemoryReqHandler = GenericRequest{
+	"POST": MethodRequestInfo{
+		ReqParams: []string{"pid", "name", "size"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			address, err := storage.AttachShared(
+				uint(numFromQuery(r, "pid")),
+				r.URL.Query().Get("name"),
+				numFromQuery(r, "size"),
+			)
+			if err != nil {
+				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+			}
+			return SimpleResponse{http.StatusOK, []byte(fmt.Sprint(address))}
+		},
+	},
+	"DELETE": MethodRequestInfo{
+		ReqParams: []string{"pid", "name"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			err := storage.DetachShared(uint(numFromQuery(r, "pid")), r.URL.Query().Get("name"))
+			if err != nil {
+				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+			}
+			return SimpleResponse{http.StatusOK, []byte{}}
+		},
+	},
+}
+
+// Sin marcos libres responde 507, el kernel bloquea al proceso hasta que se libere memoria.
+var mallocReqHandler = GenericRequest{
+	"POST": MethodRequestInfo{
+		ReqParams: []string{"pid", "size"},
+		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
+			clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+			address, err := storage.Malloc(uint(numFromQuery(r, "pid")), numFromQuery(r, "size"))
+			if errors.Is(err, storage.ErrNotEnoughMemory) {
+				return SimpleResponse{http.StatusInsufficientStorage, []byte(err.Error())}
+			}
+			if err != nil {
+				return SimpleResponse{http.StatusBadRequest, []byte(err.Error())}
+			}
+			return SimpleResponse{http.StatusOK, []byte(fmt.Sprint(address))}
+		},
+	},
+}
+
 var freeSpaceRequestHandler = GenericRequest{
 	"ANY": MethodRequestInfo{
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
@@ -303,7 +437,7 @@ var suspendProcessRequestHandler = GenericRequest{
 	"ANY": MethodRequestInfo{
 		ReqParams: []string{"pid"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.SwapDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.SwapDelay) * time.Millisecond)
 			err := storage.SuspendProcess(uint(numFromQuery(r, "pid")))
 			if err != nil {
 				slog.Error(err.Error())
@@ -318,7 +452,7 @@ var unsuspendProcessRequestHandler = GenericRequest{
 	"ANY": MethodRequestInfo{
 		ReqParams: []string{"pid"},
 		Callback: func(w http.ResponseWriter, r *http.Request) SimpleResponse {
-			time.Sleep(time.Duration(config.Values.SwapDelay) * time.Millisecond)
+			clock.Sleep(time.Duration(config.Values.SwapDelay) * time.Millisecond)
 			err := storage.UnSuspendProcess(uint(numFromQuery(r, "pid")))
 			if err != nil {
 				slog.Error(err.Error())
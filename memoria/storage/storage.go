@@ -10,8 +10,10 @@ import (
 	"os"
 	"slices"
 	"ssoo-memoria/config"
+	"ssoo-utils/clock"
 	"ssoo-utils/codeutils"
 	"ssoo-utils/logger"
+	"ssoo-utils/metrics"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,14 +29,23 @@ var opcodeStrings map[codeutils.Opcode]string = codeutils.OpcodeStrings
 type process_data struct {
 	pid       uint
 	code      []instruction
-	pageBases []int
+	threads   map[uint][]instruction // código de cada hilo secundario por TID, comparten las páginas del proceso
+	pageBases []int                  // páginas propias, las únicas que se bajan a swap
+	mappings  []mapping              // segmentos compartidos y heap, mapeados después de las páginas iniciales
 	metrics   memory_metrics
 }
 
+/*
+Cada proceso vive en el heap y systemMemory guarda su puntero, así el *process_data que devuelve
+GetDataByPID sigue siendo válido aunque se creen o eliminen otros procesos.
+
+systemMemoryMutex protege el mapa y los hilos de cada proceso. sharedMutex protege la tabla de páginas
+(pageBases y mappings), que cambian con SHM_ATTACH, SHM_DETACH, MALLOC y al volver de swap.
+*/
 var systemMemoryMutex sync.Mutex
-var systemMemory []process_data
+var systemMemory = make(map[uint]*process_data)
 
-func (p process_data) String() string {
+func (p *process_data) String() string {
 	var msg string
 	msg += "|  PID: " + fmt.Sprint(p.pid) + "\n|\n"
 	msg += "|  Reserved pages: ["
@@ -42,6 +53,14 @@ func (p process_data) String() string {
 		msg += fmt.Sprint(base/paginationConfig.PageSize) + ", "
 	}
 	msg = msg[:len(msg)-2] + "]\n|\n"
+	for _, mapping := range p.mappings {
+		if mapping.name != "" {
+			msg += "|  Shared segment: " + mapping.name + " (" + fmt.Sprint(mapping.pages) + " pages)\n"
+		}
+	}
+	if len(p.threads) > 0 {
+		msg += "|  Threads: " + fmt.Sprint(len(p.threads)) + "\n|\n"
+	}
 	msg += "|  Code (" + fmt.Sprint(len(p.code)) + " instructions)\n"
 	for index, inst := range p.code {
 		msg += "|    " + opcodeStrings[inst.Opcode] + " " + fmt.Sprint(inst.Args) + "\n"
@@ -53,20 +72,27 @@ func (p process_data) String() string {
 	return msg
 }
 
-func (p process_data) Deallocate() error {
-	err := deallocateMemory(p.pid)
+func (p *process_data) Deallocate() error {
+	for _, mapping := range p.mappings {
+		if mapping.name != "" {
+			DetachShared(p.pid, mapping.name)
+		}
+	}
+
+	var err error
+	if p.isSuspended() {
+		swapMutex.Lock()
+		err = removeFromSwap(p.pid)
+		swapMutex.Unlock()
+	} else {
+		err = deallocateMemory(p.pid)
+	}
 	if err != nil {
 		return err
 	}
-	for i := range systemMemory {
-		if systemMemory[i].pid == p.pid {
-			systemMemoryMutex.Lock()
-			systemMemory[i] = systemMemory[len(systemMemory)-1]
-			systemMemory = systemMemory[:len(systemMemory)-1]
-			systemMemoryMutex.Unlock()
-			break
-		}
-	}
+	systemMemoryMutex.Lock()
+	delete(systemMemory, p.pid)
+	systemMemoryMutex.Unlock()
 	m := p.metrics
 	logger.RequiredLog(true, p.pid, "Proceso Destruido - Métricas", map[string]string{
 		"Acc.T.Pag": fmt.Sprint(m.Page_table_accesses),
@@ -80,25 +106,34 @@ func (p process_data) Deallocate() error {
 }
 
 func GetDataByPID(pid uint) *process_data {
-	for index, process := range systemMemory {
-		if process.pid == pid {
-			return &systemMemory[index]
-		}
-	}
-	return nil
+	systemMemoryMutex.Lock()
+	defer systemMemoryMutex.Unlock()
+	return systemMemory[pid]
 }
 
-func GetInstruction(pid uint, pc int) (instruction, error) {
+// GetInstruction devuelve la instrucción pc del hilo tid del proceso, el hilo principal es el 0.
+func GetInstruction(pid uint, tid uint, pc int) (instruction, error) {
 	targetProcess := GetDataByPID(pid)
 	if targetProcess == nil {
 		return instruction{Opcode: codeutils.EXIT}, errors.New("process pid=" + fmt.Sprint(pid) + " does not exist")
 	}
-	if pc >= len(targetProcess.code) {
+	code := targetProcess.code
+	if tid != 0 {
+		systemMemoryMutex.Lock()
+		threadCode, exists := targetProcess.threads[tid]
+		systemMemoryMutex.Unlock()
+		if !exists {
+			return instruction{Opcode: codeutils.EXIT}, errors.New("thread tid=" + fmt.Sprint(tid) + " does not exist")
+		}
+		code = threadCode
+	}
+	if pc >= len(code) {
 		return instruction{Opcode: codeutils.EXIT}, errors.New("out of scope program counter")
 	}
 	targetProcess.metrics.Instructions_requested++
+	instructionsRequested.Inc()
 
-	inst := targetProcess.code[pc]
+	inst := code[pc]
 	logger.RequiredLog(true, pid, "Obtener Instrucción: "+fmt.Sprint(pc), map[string]string{
 		"Instrucción": fmt.Sprintf("(%s %v)", opcodeStrings[inst.Opcode], inst.Args),
 	})
@@ -107,29 +142,14 @@ func GetInstruction(pid uint, pc int) (instruction, error) {
 }
 
 func CreateProcess(newpid uint, codeFile io.Reader, memoryRequirement int) error {
-	if memoryRequirement > remainingMemory {
-		return errors.New("not enough user memory")
-	}
-
 	newProcessData := new(process_data)
 	newProcessData.pid = newpid
 
-	scanner := bufio.NewScanner(codeFile)
-	for scanner.Scan() {
-		if scanner.Err() != nil {
-			return scanner.Err()
-		}
-		line := scanner.Text()
-		parts := strings.Split(line, " ")
-		if len(parts) > 3 {
-			return errors.New("more arguments than possible")
-		}
-		newOpCode := codeutils.OpCodeFromString(parts[0])
-		if newOpCode == -1 {
-			return errors.New("opcode not recognized")
-		}
-		newProcessData.code = append(newProcessData.code, instruction{Opcode: newOpCode, Args: parts[1:]})
+	code, err := parseCode(codeFile)
+	if err != nil {
+		return err
 	}
+	newProcessData.code = code
 
 	if memoryRequirement != 0 {
 		reservedPageBases, err := allocateMemory(memoryRequirement)
@@ -141,13 +161,47 @@ func CreateProcess(newpid uint, codeFile io.Reader, memoryRequirement int) error
 		newProcessData.pageBases = reservedPageBases
 	}
 	systemMemoryMutex.Lock()
-	systemMemory = append(systemMemory, *newProcessData)
+	systemMemory[newpid] = newProcessData
 	systemMemoryMutex.Unlock()
 
 	logger.RequiredLog(true, newpid, "Proceso Creado", map[string]string{"Tamaño": fmt.Sprint(memoryRequirement)})
 	return nil
 }
 
+func parseCode(codeFile io.Reader) ([]instruction, error) {
+	return codeutils.ParseCode(codeFile)
+}
+
+// CreateThread carga el código de un hilo secundario del proceso pid. No reserva memoria, usa la del proceso.
+func CreateThread(pid uint, tid uint, codeFile io.Reader) error {
+	if tid == 0 {
+		return errors.New("tid 0 is the main thread")
+	}
+	code, err := parseCode(codeFile)
+	if err != nil {
+		return err
+	}
+
+	targetProcess := GetDataByPID(pid)
+	if targetProcess == nil {
+		return errors.New("process pid=" + fmt.Sprint(pid) + " does not exist")
+	}
+	systemMemoryMutex.Lock()
+	defer systemMemoryMutex.Unlock()
+	if targetProcess.threads == nil {
+		targetProcess.threads = make(map[uint][]instruction)
+	}
+	targetProcess.threads[tid] = code
+
+	logger.RequiredLog(true, pid, "Hilo Creado", map[string]string{"TID": fmt.Sprint(tid)})
+	return nil
+}
+
+// Un proceso suspendido tiene sus páginas en swap y sus marcos ya liberados.
+func (p *process_data) isSuspended() bool {
+	return p.metrics.Suspensions > p.metrics.Unsuspensions
+}
+
 func DeleteProcess(pidToDelete uint) error {
 	process_data := GetDataByPID(pidToDelete)
 	if process_data == nil {
@@ -164,6 +218,27 @@ func DeleteProcess(pidToDelete uint) error {
 
 //#region SECTION: USER MEMORY
 
+// Totales de todos los procesos para /metrics, memory_metrics se pierde al eliminar cada proceso.
+var (
+	pageTableAccesses     = metrics.NewCounter("ssoo_memoria_page_table_accesses_total", "Accesos a tablas de páginas.")
+	instructionsRequested = metrics.NewCounter("ssoo_memoria_instructions_requested_total", "Instrucciones solicitadas por las CPUs.")
+	reads                 = metrics.NewCounter("ssoo_memoria_reads_total", "Lecturas de memoria de usuario.")
+	writes                = metrics.NewCounter("ssoo_memoria_writes_total", "Escrituras en memoria de usuario.")
+	swapOuts              = metrics.NewCounter("ssoo_memoria_swap_out_total", "Procesos bajados a swap.")
+	swapIns               = metrics.NewCounter("ssoo_memoria_swap_in_total", "Procesos subidos de swap.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ssoo_memoria_free_bytes", "Memoria de usuario libre.", func() float64 {
+		return float64(GetRemainingMemory())
+	})
+	metrics.NewGaugeFunc("ssoo_memoria_processes", "Procesos cargados en memoria o swap.", func() float64 {
+		systemMemoryMutex.Lock()
+		defer systemMemoryMutex.Unlock()
+		return float64(len(systemMemory))
+	})
+}
+
 type memory_metrics struct {
 	Page_table_accesses    int
 	Instructions_requested int
@@ -198,6 +273,7 @@ func GetFromMemory(pid uint, base int, delta int) (byte, error) {
 		return 0, errors.New("out of bounds page memory access")
 	}
 	GetDataByPID(pid).metrics.Reads++
+	reads.Inc()
 	return userMemory[base+delta], nil
 }
 
@@ -210,11 +286,14 @@ func WriteToMemory(pid uint, base int, delta int, value byte) error {
 	userMemoryMutex.Unlock()
 
 	GetDataByPID(pid).metrics.Writes++
+	writes.Inc()
 
 	return nil
 }
 
 func GetRemainingMemory() int {
+	allocatorMutex.Lock()
+	defer allocatorMutex.Unlock()
 	return remainingMemory
 }
 
@@ -226,12 +305,15 @@ var nPages int
 var pageBases []int
 var reservationBits []bool
 
+// allocatorMutex protege remainingMemory y reservationBits. Se puede tomar con sharedMutex tomado, nunca al revés.
+var allocatorMutex sync.Mutex
+
 func HasPage(pid uint, base int) (bool, error) {
 	processData := GetDataByPID(pid)
 	if processData == nil {
 		return false, errors.New("couldn't find process with pid")
 	}
-	if !slices.Contains(processData.pageBases, base) {
+	if base < 0 || !slices.Contains(processData.mappedPages(), base) {
 		return false, errors.New("process does not have this page assigned")
 	}
 	return true, nil
@@ -242,6 +324,7 @@ func GetPage(pid uint, base int) ([]byte, error) {
 		return nil, err
 	}
 	GetDataByPID(pid).metrics.Reads += config.Values.PageSize
+	reads.Add(float64(config.Values.PageSize))
 	return userMemory[base : base+paginationConfig.PageSize], nil
 }
 
@@ -286,7 +369,7 @@ func LogicAddressToFrame(pid uint, address []int) (base int, err error) {
 		err = errors.New("could't find process with pid")
 		return
 	}
-	processPageBases := process.pageBases
+	processPageBases := process.mappedPages()
 	processPageIndex := 0
 
 	var f_pageTableSize float64 = float64(pageTableSize)
@@ -297,8 +380,9 @@ func LogicAddressToFrame(pid uint, address []int) (base int, err error) {
 			return
 		}
 		processPageIndex += num * int(math.Pow(f_pageTableSize, f_levels-1-float64(i)))
-		time.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
+		clock.Sleep(time.Duration(config.Values.MemoryDelay) * time.Millisecond)
 		process.metrics.Page_table_accesses++
+		pageTableAccesses.Inc()
 	}
 
 	if processPageIndex >= len(processPageBases) {
@@ -307,9 +391,241 @@ func LogicAddressToFrame(pid uint, address []int) (base int, err error) {
 	}
 
 	base = processPageBases[processPageIndex]
+	if base < 0 {
+		err = errors.New("page of a detached shared segment")
+	}
 	return
 }
 
+// IsSharedFrame indica si el marco puede estar en uso desde otra CPU: es de un segmento compartido
+// o el proceso tiene hilos, que comparten todas sus páginas.
+func IsSharedFrame(pid uint, base int) bool {
+	process := GetDataByPID(pid)
+	if process == nil {
+		return false
+	}
+	systemMemoryMutex.Lock()
+	threaded := len(process.threads) > 0
+	systemMemoryMutex.Unlock()
+	if threaded {
+		return true
+	}
+
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	for _, segment := range sharedSegments {
+		if slices.Contains(segment.pageBases, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// logicalToPhysical traduce una dirección lógica lineal (página * page_size + desplazamiento) del proceso.
+func logicalToPhysical(pid uint, address int) (base int, delta int, err error) {
+	process := GetDataByPID(pid)
+	if process == nil {
+		return 0, 0, errors.New("couldn't find process with pid")
+	}
+	if process.isSuspended() {
+		return 0, 0, errors.New("process is suspended")
+	}
+	pages := process.mappedPages()
+	pageIndex := address / paginationConfig.PageSize
+	if address < 0 || pageIndex >= len(pages) || pages[pageIndex] < 0 {
+		return 0, 0, errors.New("out of bounds process memory access")
+	}
+	return pages[pageIndex], address % paginationConfig.PageSize, nil
+}
+
+// ReadLogical lee size bytes del proceso desde la dirección lógica address, aunque crucen páginas.
+func ReadLogical(pid uint, address int, size int) ([]byte, error) {
+	data := make([]byte, 0, size)
+	for offset := range size {
+		base, delta, err := logicalToPhysical(pid, address+offset)
+		if err != nil {
+			return nil, err
+		}
+		value, err := GetFromMemory(pid, base, delta)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, value)
+	}
+	return data, nil
+}
+
+// WriteLogical escribe data en el proceso desde la dirección lógica address, aunque crucen páginas.
+func WriteLogical(pid uint, address int, data []byte) error {
+	// Se valida todo el rango antes de escribir para no dejar escrituras a medias.
+	if len(data) > 0 {
+		if _, _, err := logicalToPhysical(pid, address+len(data)-1); err != nil {
+			return err
+		}
+	}
+	for offset, value := range data {
+		base, delta, err := logicalToPhysical(pid, address+offset)
+		if err != nil {
+			return err
+		}
+		if err := WriteToMemory(pid, base, delta, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//#endregion
+
+//#region SHARED MEMORY
+
+/*
+Segmentos de memoria compartida para SHM_ATTACH y SHM_DETACH.
+
+Un segmento tiene sus propios marcos y se mapea en la tabla de páginas de cada proceso que lo adjunta,
+a continuación de sus páginas propias y de los segmentos que adjuntó antes.
+Los marcos se liberan cuando el último proceso lo desadjunta o termina. Nunca van a swap:
+suspender a un proceso baja solo sus páginas propias.
+*/
+
+type shared_segment struct {
+	name      string
+	size      int
+	pageBases []int
+	sharers   []uint // PIDs que lo tienen mapeado
+}
+
+// Un segmento desadjuntado deja su lugar (name vacío) para no mover las direcciones de los siguientes.
+type mapping struct {
+	name  string
+	pages int
+	heap  bool // páginas propias agregadas con MALLOC, están al final de pageBases
+}
+
+var sharedMutex sync.Mutex
+var sharedSegments = make(map[string]*shared_segment)
+
+// mappedPages devuelve la tabla de páginas completa del proceso: las propias y las de sus segmentos.
+// Las páginas de un segmento desadjuntado valen -1.
+func (p *process_data) mappedPages() []int {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	next := p.initialPages()
+	pages := slices.Clone(p.pageBases[:next])
+	for _, mapping := range p.mappings {
+		segment, exists := sharedSegments[mapping.name]
+		switch {
+		case mapping.heap:
+			pages = append(pages, p.pageBases[next:next+mapping.pages]...)
+			next += mapping.pages
+		case exists && mapping.name != "":
+			pages = append(pages, segment.pageBases...)
+		default:
+			for range mapping.pages {
+				pages = append(pages, -1)
+			}
+		}
+	}
+	return pages
+}
+
+// initialPages devuelve cuántas páginas propias se reservaron al crear el proceso, antes de cualquier mapeo.
+// Requiere sharedMutex tomado.
+func (p *process_data) initialPages() int {
+	pages := len(p.pageBases)
+	for _, mapping := range p.mappings {
+		if mapping.heap {
+			pages -= mapping.pages
+		}
+	}
+	return pages
+}
+
+// AttachShared mapea el segmento name en el proceso, creándolo con size bytes si no existe.
+// Devuelve la dirección lógica donde quedó mapeado.
+func AttachShared(pid uint, name string, size int) (int, error) {
+	process := GetDataByPID(pid)
+	if process == nil {
+		return 0, errors.New("couldn't find process with pid")
+	}
+	if name == "" || size <= 0 {
+		return 0, errors.New("invalid shared segment")
+	}
+
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+
+	address := process.initialPages()
+	for _, mapping := range process.mappings {
+		if mapping.name == name {
+			return address * paginationConfig.PageSize, nil
+		}
+		address += mapping.pages
+	}
+	address *= paginationConfig.PageSize
+
+	segment, exists := sharedSegments[name]
+	if !exists {
+		pageBases, err := allocateMemory(size)
+		if err != nil {
+			return 0, err
+		}
+		userMemoryMutex.Lock()
+		for _, base := range pageBases {
+			clear(userMemory[base : base+paginationConfig.PageSize])
+		}
+		userMemoryMutex.Unlock()
+
+		segment = &shared_segment{name: name, size: size, pageBases: pageBases}
+		sharedSegments[name] = segment
+		slog.Info("Segmento compartido creado", "name", name, "size", size, "pages", len(pageBases))
+	} else if size > segment.size {
+		return 0, fmt.Errorf("shared segment %s has %d bytes, requested %d", name, segment.size, size)
+	}
+
+	segment.sharers = append(segment.sharers, pid)
+	process.mappings = append(process.mappings, mapping{name: name, pages: len(segment.pageBases)})
+
+	logger.RequiredLog(true, pid, "Segmento Compartido Adjuntado", map[string]string{
+		"Nombre":     name,
+		"Dir.Lógica": fmt.Sprint(address),
+		"Procesos":   fmt.Sprint(len(segment.sharers)),
+	})
+	return address, nil
+}
+
+// DetachShared quita el segmento name del proceso. Si era el último proceso que lo usaba se liberan sus marcos.
+func DetachShared(pid uint, name string) error {
+	process := GetDataByPID(pid)
+	if process == nil {
+		return errors.New("couldn't find process with pid")
+	}
+
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+
+	index := slices.IndexFunc(process.mappings, func(m mapping) bool { return m.name == name })
+	segment, exists := sharedSegments[name]
+	if index < 0 || !exists {
+		return fmt.Errorf("process does not have shared segment %s attached", name)
+	}
+	process.mappings[index].name = ""
+	segment.sharers = slices.DeleteFunc(segment.sharers, func(sharer uint) bool { return sharer == pid })
+
+	logger.RequiredLog(true, pid, "Segmento Compartido Desadjuntado", map[string]string{
+		"Nombre":   name,
+		"Procesos": fmt.Sprint(len(segment.sharers)),
+	})
+
+	if len(segment.sharers) > 0 {
+		return nil
+	}
+	freeFrames(segment.pageBases)
+	delete(sharedSegments, name)
+	slog.Info("Segmento compartido liberado", "name", name, "pages", len(segment.pageBases))
+	return nil
+}
+
 //#endregion
 
 //#region MEMORY DUMP
@@ -344,7 +660,7 @@ func Memory_Dump(pid uint) error {
 	if processData == nil {
 		return errors.New("couldn't find process with pid")
 	}
-	dump_file, err := os.Create(config.Values.DumpPath + fmt.Sprint(processData.pid, "-", time.Now().Format("2006-01-02_15:04:05.9999")+".dmp"))
+	dump_file, err := os.Create(config.Values.DumpPath + fmt.Sprint(processData.pid, "-", clock.Now().Format("2006-01-02_15:04:05.9999")+".dmp"))
 	if err != nil {
 		return err
 	}
@@ -353,7 +669,7 @@ func Memory_Dump(pid uint) error {
 	dump_file.WriteString(processData.String())
 	dump_file.WriteString("---------------(     Pages     )---------------\n")
 	dump_file.WriteString("| Index |  Base  | Content\n")
-	for i, pageBase := range processData.pageBases {
+	for i, pageBase := range processData.mappedPages() {
 		istr := fmt.Sprint(i)
 		istr = strings.Repeat(" ", max(0, 5-len(istr))) + istr
 		bstr := fmt.Sprint(pageBase)
@@ -532,6 +848,7 @@ func SuspendProcess(pid uint) error {
 	}
 
 	process_data.metrics.Suspensions++
+	swapOuts.Inc()
 	return err
 }
 
@@ -573,7 +890,9 @@ func UnSuspendProcess(pid uint) error {
 		return err
 	}
 
+	sharedMutex.Lock()
 	process_data.pageBases = pageBases
+	sharedMutex.Unlock()
 
 	//drop pagecount and block separator from chunks
 	chunks = chunks[1 : len(chunks)-1]
@@ -590,6 +909,7 @@ func UnSuspendProcess(pid uint) error {
 	}
 
 	process_data.metrics.Unsuspensions++
+	swapIns.Inc()
 
 	return nil
 }
@@ -637,11 +957,16 @@ func InitializeUserMemory() {
 
 //#region MALLOC/FREE
 
+var ErrNotEnoughMemory = errors.New("not enough memory")
+
 func allocateMemory(size int) ([]int, error) {
-	if size > remainingMemory {
-		return nil, errors.New("not enough memory")
-	}
+	allocatorMutex.Lock()
+	defer allocatorMutex.Unlock()
+
 	requiredPages := int(math.Ceil(float64(size) / float64(paginationConfig.PageSize)))
+	if requiredPages*paginationConfig.PageSize > remainingMemory {
+		return nil, ErrNotEnoughMemory
+	}
 	slog.Info("allocating memory", "bytes", size, "pages", requiredPages)
 	remainingMemory -= paginationConfig.PageSize * requiredPages
 	if remainingMemory < 0 {
@@ -663,20 +988,76 @@ func allocateMemory(size int) ([]int, error) {
 	return nil, errors.New("something wrong ocurred on memory allocation")
 }
 
+/*
+Malloc agrega al proceso las páginas necesarias para size bytes, al final de su espacio de direcciones.
+
+Devuelve la dirección lógica de la primera página nueva, que es el tamaño que tenía el espacio de direcciones.
+Las páginas son propias del proceso, se bajan a swap con el resto al suspenderlo.
+Si no hay marcos libres devuelve ErrNotEnoughMemory y el proceso no cambia.
+*/
+func Malloc(pid uint, size int) (int, error) {
+	process := GetDataByPID(pid)
+	if process == nil {
+		return 0, errors.New("couldn't find process with pid")
+	}
+	if size <= 0 {
+		return 0, errors.New("invalid size")
+	}
+	if process.isSuspended() {
+		return 0, errors.New("process is suspended")
+	}
+
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+
+	address := process.initialPages()
+	for _, mapping := range process.mappings {
+		address += mapping.pages
+	}
+	address *= paginationConfig.PageSize
+
+	pageBases, err := allocateMemory(size)
+	if err != nil {
+		return 0, err
+	}
+	userMemoryMutex.Lock()
+	for _, base := range pageBases {
+		clear(userMemory[base : base+paginationConfig.PageSize])
+	}
+	userMemoryMutex.Unlock()
+
+	process.pageBases = append(process.pageBases, pageBases...)
+	process.mappings = append(process.mappings, mapping{pages: len(pageBases), heap: true})
+
+	logger.RequiredLog(true, pid, "Memoria Dinámica Asignada", map[string]string{
+		"Dir.Lógica": fmt.Sprint(address),
+		"Páginas":    fmt.Sprint(len(pageBases)),
+	})
+	return address, nil
+}
+
 func deallocateMemory(pid uint) error {
 	process_data := GetDataByPID(pid)
 	if process_data == nil {
 		return errors.New("couldn't find process with id")
 	}
-	slog.Info("deallocating memory", "pid", pid, "size", len(process_data.pageBases)*config.Values.PageSize)
-	if len(process_data.pageBases) == 0 {
-		return nil
-	}
-	for _, pageBase := range process_data.pageBases {
+	sharedMutex.Lock()
+	pageBases := process_data.pageBases
+	sharedMutex.Unlock()
+
+	slog.Info("deallocating memory", "pid", pid, "size", len(pageBases)*config.Values.PageSize)
+	freeFrames(pageBases)
+	return nil
+}
+
+// freeFrames devuelve los marcos de pageBases a la memoria libre.
+func freeFrames(pageBases []int) {
+	allocatorMutex.Lock()
+	defer allocatorMutex.Unlock()
+	for _, pageBase := range pageBases {
 		reservationBits[pageBase/paginationConfig.PageSize] = false
 	}
-	remainingMemory += len(process_data.pageBases) * paginationConfig.PageSize
-	return nil
+	remainingMemory += len(pageBases) * paginationConfig.PageSize
 }
 
 //#endregion
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"ssoo-memoria/config"
+	"ssoo-utils/codeutils"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseCode(t *testing.T) {
+	cases := []struct {
+		name   string
+		code   string
+		opcode codeutils.Opcode
+		args   []string
+	}{
+		{"INIT_PROC sin prioridad", "INIT_PROC proceso1 256", codeutils.INIT_PROC, []string{"proceso1", "256"}},
+		{"INIT_PROC con prioridad", "INIT_PROC proceso1 256 3", codeutils.INIT_PROC, []string{"proceso1", "256", "3"}},
+		{"THREAD_CREATE sin prioridad", "THREAD_CREATE hilo", codeutils.THREAD_CREATE, []string{"hilo"}},
+		{"WAIT_CHILD sin hijo", "WAIT_CHILD", codeutils.WAIT_CHILD, []string{}},
+		{"MALLOC sin destino", "MALLOC 64", codeutils.MALLOC, []string{"64"}},
+		{"MALLOC con destino", "MALLOC 64 0", codeutils.MALLOC, []string{"64", "0"}},
+		{"SHM_ATTACH con destino", "SHM_ATTACH buffer 128 0", codeutils.SHM_ATTACH, []string{"buffer", "128", "0"}},
+		{"MSG_SEND", "MSG_SEND pedidos 32 16", codeutils.MSG_SEND, []string{"pedidos", "32", "16"}},
+		{"MSG_RECV", "MSG_RECV pedidos 64 16", codeutils.MSG_RECV, []string{"pedidos", "64", "16"}},
+		{"IO_STDOUT", "IO_STDOUT PANTALLA 0 32", codeutils.IO_STDOUT, []string{"PANTALLA", "0", "32"}},
+		{"IO_STDIN", "IO_STDIN TECLADO 32 8", codeutils.IO_STDIN, []string{"TECLADO", "32", "8"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			code, err := parseCode(strings.NewReader("NOOP\n" + c.code + "\nEXIT"))
+			if err != nil {
+				t.Fatalf("parseCode: %v", err)
+			}
+			if len(code) != 3 {
+				t.Fatalf("se esperaban 3 instrucciones, hay %d", len(code))
+			}
+			if code[1].Opcode != c.opcode || !slices.Equal(code[1].Args, c.args) {
+				t.Errorf("instrucción %v %v, se esperaba %v %v", code[1].Opcode, code[1].Args, c.opcode, c.args)
+			}
+		})
+	}
+}
+
+func TestParseCodeRejectsArity(t *testing.T) {
+	for _, line := range []string{
+		"INIT_PROC proceso1",
+		"INIT_PROC proceso1 256 3 4",
+		"NOOP 1",
+		"WRITE 0",
+		"SHM_ATTACH seg 64 0 1",
+		"NOEXISTE 1",
+	} {
+		if _, err := parseCode(strings.NewReader(line)); err == nil {
+			t.Errorf("%q: se esperaba un error", line)
+		}
+	}
+}
+
+func TestCreateProcessWithFileSyscalls(t *testing.T) {
+	program := "F_CREATE notas\nF_TRUNCATE notas 64\nF_WRITE notas 0 16 0\nF_READ notas 32 16 0\nF_DELETE notas\nEXIT"
+	if err := CreateProcess(9001, strings.NewReader(program), 0); err != nil {
+		t.Fatalf("CreateProcess: %v", err)
+	}
+	process := GetDataByPID(9001)
+	if process == nil {
+		t.Fatal("el proceso no quedó cargado")
+	}
+	write := process.code[2]
+	if write.Opcode != codeutils.F_WRITE || !slices.Equal(write.Args, []string{"notas", "0", "16", "0"}) {
+		t.Errorf("F_WRITE cargado como %v %v", write.Opcode, write.Args)
+	}
+}
+
+/*
+Estrés del reparto de marcos, pensado para correr con go test -race.
+
+Cada goroutine crea un proceso, le agrega heap, adjunta y suelta un segmento compartido y lo elimina,
+a la vez que las demás. Al final toda la memoria tiene que estar libre y sin marcos reservados.
+*/
+func TestAllocatorConcurrentProcesses(t *testing.T) {
+	const (
+		workers    = 8
+		iterations = 50
+		pageSize   = 16
+	)
+	config.Values.MemorySize = 64 * pageSize
+	config.Values.PageSize = pageSize
+	config.Values.EntriesPerPage = 4
+	config.Values.NumberOfLevels = 3
+	config.Values.SwapfilePath = filepath.Join(t.TempDir(), "swapfile.bin")
+	InitializeUserMemory()
+
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				pid := uint(10000 + worker*iterations + i)
+				if err := CreateProcess(pid, strings.NewReader("NOOP\nEXIT"), 2*pageSize); err != nil {
+					t.Errorf("CreateProcess(%d): %v", pid, err)
+					return
+				}
+				if _, err := Malloc(pid, pageSize); err != nil {
+					t.Errorf("Malloc(%d): %v", pid, err)
+				}
+				segment := fmt.Sprint("seg", i%3)
+				if _, err := AttachShared(pid, segment, pageSize); err != nil {
+					t.Errorf("AttachShared(%d): %v", pid, err)
+				}
+				if err := DetachShared(pid, segment); err != nil {
+					t.Errorf("DetachShared(%d): %v", pid, err)
+				}
+				if err := DeleteProcess(pid); err != nil {
+					t.Errorf("DeleteProcess(%d): %v", pid, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if free := GetRemainingMemory(); free != config.Values.MemorySize {
+		t.Errorf("quedaron %d bytes libres, se esperaban %d", free, config.Values.MemorySize)
+	}
+	if reserved := slices.Index(reservationBits, true); reserved >= 0 {
+		t.Errorf("el marco %d quedó reservado", reserved)
+	}
+}
@@ -68,6 +68,7 @@ func main() {
 		{"cpu", "ssoo-cpu", "cpu.exe", "cpu/config", time.Now(), time.Now()},
 		{"io", "ssoo-io", "io.exe", "io/config", time.Now(), time.Now()},
 		{"memoria", "ssoo-memoria", "memoria.exe", "memoria/config", time.Now(), time.Now()},
+		{"filesystem", "ssoo-filesystem", "filesystem.exe", "filesystem/config", time.Now(), time.Now()},
 	}
 	initialTimestamp := time.Now()
 
@@ -0,0 +1,172 @@
+package clock
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+Reloj compartido por todos los módulos.
+
+En modo "real" (por defecto) es un simple envoltorio de time.
+
+En modo "virtual" el tiempo es simulado y avanza por eventos discretos: cada Sleep/NewTimer registra
+un evento y el reloj salta directamente al próximo cuando no queda trabajo en curso en ningún módulo,
+sin esperar el tiempo real. El Kernel es el dueño del reloj virtual y lo expone por HTTP (ver Handler),
+el resto de los módulos lo consultan de forma remota.
+
+El trabajo en curso se cuenta de forma explícita:
+  - Hold suma un trabajo y Release lo resta. No tienen que ser de la misma goroutine ni del mismo módulo,
+    un trabajo se puede pasar de uno a otro (ej. el kernel toma uno al despachar un proceso y la CPU
+    lo suelta cuando el proceso deja de ejecutar).
+  - Sleep presupone que quien llama tiene un trabajo: lo suelta mientras espera y lo recupera al vencer.
+  - Un Timer que vence suma un trabajo para quien lo atiende, que lo suelta con Done.
+  - Mutex pasa el trabajo de quien lo suelta a quien estaba esperando.
+
+Así el reloj no avanza mientras un módulo reacciona a un evento, sin importar cuánto tarde en tiempo real.
+*/
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) *Timer
+	Hold()
+	Release()
+}
+
+type Timer struct {
+	C    <-chan time.Time
+	done func()
+}
+
+// Done termina con el timer: lo cancela si no venció y, si venció, suelta el trabajo de atenderlo.
+// Se llama una vez que se atendió (o se descartó) el vencimiento, se puede llamar más de una vez.
+func (t *Timer) Done() {
+	if t.done != nil {
+		t.done()
+	}
+}
+
+var current Clock = realClock{}
+
+func Use(c Clock) { current = c }
+
+func Current() Clock { return current }
+
+func IsVirtual() bool {
+	_, local := current.(*Virtual)
+	_, remote := current.(*Remote)
+	return local || remote
+}
+
+/*
+Setup configura el reloj según el modo de la config del módulo.
+
+(mode) "" o "real" para el reloj de sistema, "virtual" para el reloj simulado.
+
+(master) vacío si este módulo es el dueño del reloj virtual, o "ip:puerto" del módulo que lo expone.
+*/
+func Setup(mode string, master string) error {
+	switch mode {
+	case "", "real":
+		Use(realClock{})
+	case "virtual":
+		if master == "" {
+			Use(NewVirtual(Epoch))
+		} else {
+			Use(NewRemote(master))
+		}
+	default:
+		return fmt.Errorf("modo de reloj '%s' inválido, usar 'real' o 'virtual'", mode)
+	}
+	return nil
+}
+
+func Now() time.Time { return current.Now() }
+
+func Since(t time.Time) time.Duration { return current.Now().Sub(t) }
+
+func NewTimer(d time.Duration) *Timer { return current.NewTimer(d) }
+
+func Sleep(d time.Duration) { current.Sleep(d) }
+
+// Hold marca un trabajo en curso, el reloj virtual no avanza hasta que se suelte con Release.
+func Hold() { current.Hold() }
+
+// Release suelta un trabajo tomado con Hold (o recibido de otro módulo).
+func Release() { current.Release() }
+
+// Holding atiende cada pedido con un trabajo tomado. Es para los pedidos que no llegan como parte de otro
+// trabajo, ej. los de un usuario, y que pueden hacer Sleep o tomar un Mutex.
+func Holding(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Hold()
+		defer Release()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// #region REAL
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+func (realClock) NewTimer(d time.Duration) *Timer {
+	timer := time.NewTimer(d)
+	return &Timer{C: timer.C, done: func() { timer.Stop() }}
+}
+
+func (realClock) Hold() {}
+
+func (realClock) Release() {}
+
+// #endregion
+
+// #region MUTEX
+
+/*
+Mutex es un sync.Mutex que se puede tomar mientras el dueño duerme en el reloj.
+
+Con un sync.Mutex quien espera conserva su trabajo, y si el dueño hace un Sleep el reloj virtual nunca avanza.
+Acá quien espera suelta su trabajo, y al soltar el mutex el dueño toma uno y se lo pasa junto con el mutex,
+en orden de llegada. Quien llama a Lock tiene que tener un trabajo, igual que con Sleep.
+*/
+type Mutex struct {
+	mu      sync.Mutex
+	locked  bool
+	waiters []chan struct{}
+}
+
+func (m *Mutex) Lock() {
+	m.mu.Lock()
+	if !m.locked {
+		m.locked = true
+		m.mu.Unlock()
+		return
+	}
+	turn := make(chan struct{})
+	m.waiters = append(m.waiters, turn)
+	m.mu.Unlock()
+
+	Release()
+	<-turn
+}
+
+func (m *Mutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.waiters) == 0 {
+		m.locked = false
+		return
+	}
+	turn := m.waiters[0]
+	m.waiters = m.waiters[1:]
+	Hold()
+	close(turn)
+}
+
+// #endregion
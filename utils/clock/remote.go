@@ -0,0 +1,188 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Remote usa el reloj virtual que expone otro módulo (ver Handler).
+// Si el dueño del reloj no responde el módulo no puede seguir: con otro reloj el tiempo dejaría de ser
+// el mismo para todos, así que cualquier error es fatal (ver fail).
+type Remote struct {
+	baseUrl string
+}
+
+func NewRemote(master string) *Remote {
+	return &Remote{baseUrl: "http://" + master + "/clock/"}
+}
+
+// fail corta el módulo por un error con el reloj del dueño.
+func fail(operation string, err error) {
+	slog.Error("Error usando el reloj virtual", "operación", operation, "error", err)
+	panic(fmt.Errorf("reloj virtual (%s): %w", operation, err))
+}
+
+func (r *Remote) Now() time.Time {
+	resp, err := http.Get(r.baseUrl + "now")
+	if err != nil {
+		fail("now", err)
+	}
+	defer resp.Body.Close()
+	return r.parseInstant("now", resp)
+}
+
+func (r *Remote) Hold() {
+	r.post("hold")
+}
+
+func (r *Remote) Release() {
+	r.post("release")
+}
+
+func (r *Remote) post(operation string) {
+	resp, err := http.Post(r.baseUrl+operation, "text/plain", http.NoBody)
+	if err != nil {
+		fail(operation, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fail(operation, fmt.Errorf("status %d", resp.StatusCode))
+	}
+}
+
+func (r *Remote) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	resp, err := http.Post(r.baseUrl+"sleep?ns="+fmt.Sprint(d.Nanoseconds()), "text/plain", http.NoBody)
+	if err != nil {
+		fail("sleep", err)
+	}
+	defer resp.Body.Close()
+	r.parseInstant("sleep", resp)
+}
+
+func (r *Remote) NewTimer(d time.Duration) *Timer {
+	ch := make(chan time.Time, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	url := r.baseUrl + "timer?ns=" + fmt.Sprint(d.Nanoseconds())
+
+	var mu sync.Mutex
+	fired, done := false, false
+
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, http.NoBody)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fail("timer", err)
+		}
+		defer resp.Body.Close()
+		now := r.parseInstant("timer", resp)
+
+		mu.Lock()
+		fired = true
+		mu.Unlock()
+		ch <- now
+	}()
+
+	return &Timer{C: ch, done: func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		done = true
+		if fired {
+			r.Release()
+		} else {
+			cancel()
+		}
+	}}
+}
+
+func (r *Remote) parseInstant(operation string, resp *http.Response) time.Time {
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fail(operation, fmt.Errorf("status %d: %s", resp.StatusCode, body))
+	}
+	nanos, err := strconv.ParseInt(string(body), 10, 64)
+	if err != nil {
+		fail(operation, err)
+	}
+	return time.Unix(0, nanos)
+}
+
+/*
+Handler expone el reloj virtual v para el resto de los módulos:
+
+GET /clock/now devuelve el instante actual en nanosegundos unix.
+
+POST /clock/hold y POST /clock/release toman y sueltan un trabajo (ver Hold).
+
+POST /clock/sleep?ns= suelta el trabajo de quien llama hasta que vence el tiempo pedido y devuelve el instante de vencimiento.
+
+POST /clock/timer?ns= espera como un Timer: al vencer quien llama queda con un trabajo, que suelta con /clock/release.
+*/
+func Handler(v *Virtual) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clock/now", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprint(v.Now().UnixNano())))
+	})
+	mux.HandleFunc("/clock/hold", onPost(func(w http.ResponseWriter, r *http.Request) {
+		v.Hold()
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("/clock/release", onPost(func(w http.ResponseWriter, r *http.Request) {
+		v.Release()
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("/clock/sleep", onPost(func(w http.ResponseWriter, r *http.Request) {
+		nanos, err := strconv.ParseInt(r.URL.Query().Get("ns"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ns", http.StatusBadRequest)
+			return
+		}
+		if now, ok := v.sleep(r.Context(), time.Duration(nanos)); ok {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(fmt.Sprint(now.UnixNano())))
+		}
+	}))
+	mux.HandleFunc("/clock/timer", onPost(func(w http.ResponseWriter, r *http.Request) {
+		nanos, err := strconv.ParseInt(r.URL.Query().Get("ns"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ns", http.StatusBadRequest)
+			return
+		}
+		timer := v.NewTimer(time.Duration(nanos))
+		select {
+		case now := <-timer.C:
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write([]byte(fmt.Sprint(now.UnixNano()))); err != nil {
+				timer.Done()
+			}
+		case <-r.Context().Done():
+			timer.Done()
+		}
+	}))
+	return mux
+}
+
+func onPost(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,207 @@
+package clock
+
+import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Epoch es el instante en el que arranca el reloj virtual, fijo para que las corridas sean reproducibles.
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// StuckWarning es cuánto tiempo real puede estar el reloj virtual sin avanzar, con eventos pendientes,
+// antes de avisar que hay trabajos que no se soltaron. Sólo avisa, el reloj sigue esperando.
+var StuckWarning = 10 * time.Second
+
+type event struct {
+	deadline time.Time
+	seq      uint64
+	ch       chan time.Time
+	index    int
+	fired    bool
+}
+
+type eventHeap []*event
+
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].deadline.Equal(h[j].deadline) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deadline.Before(h[j].deadline)
+}
+func (h eventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *eventHeap) Push(x any) {
+	e := x.(*event)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *eventHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Virtual es un reloj de eventos discretos: los eventos se disparan en orden de vencimiento
+// (y de registro si vencen juntos) y el tiempo salta al vencimiento de cada uno.
+// Sólo se dispara un evento cuando no hay trabajos en curso (ver Hold).
+type Virtual struct {
+	mu     sync.Mutex
+	now    time.Time
+	events eventHeap
+	seq    uint64
+	active int // trabajos en curso, el reloj no avanza mientras haya alguno
+	wake   chan struct{}
+}
+
+func NewVirtual(start time.Time) *Virtual {
+	v := &Virtual{
+		now:    start,
+		events: make(eventHeap, 0),
+		wake:   make(chan struct{}, 1),
+	}
+	go v.run()
+	return v
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.now
+}
+
+func (v *Virtual) Hold() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.active++
+}
+
+func (v *Virtual) Release() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.release()
+}
+
+// release resta un trabajo. Requiere el lock tomado.
+func (v *Virtual) release() {
+	if v.active == 0 {
+		slog.Error("Reloj virtual: se soltó un trabajo que nadie tenía")
+		return
+	}
+	v.active--
+	if v.active == 0 {
+		v.notify()
+	}
+}
+
+func (v *Virtual) notify() {
+	select {
+	case v.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule registra un evento que vence en d. Requiere el lock tomado.
+func (v *Virtual) schedule(d time.Duration) *event {
+	v.seq++
+	e := &event{deadline: v.now.Add(d), seq: v.seq, ch: make(chan time.Time, 1)}
+	heap.Push(&v.events, e)
+	v.notify()
+	return e
+}
+
+func (v *Virtual) Sleep(d time.Duration) {
+	v.sleep(context.Background(), d)
+}
+
+// sleep suelta el trabajo de quien llama hasta que vence d. Si ctx se cancela antes el trabajo no se
+// recupera: quien esperaba ya no está (ej. el módulo remoto se cerró). Devuelve false en ese caso.
+func (v *Virtual) sleep(ctx context.Context, d time.Duration) (time.Time, bool) {
+	v.mu.Lock()
+	if d <= 0 {
+		defer v.mu.Unlock()
+		return v.now, true
+	}
+	e := v.schedule(d)
+	v.release()
+	v.mu.Unlock()
+
+	select {
+	case now := <-e.ch:
+		return now, true
+	case <-ctx.Done():
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if e.index >= 0 {
+			heap.Remove(&v.events, e.index)
+		} else {
+			v.release()
+		}
+		return time.Time{}, false
+	}
+}
+
+func (v *Virtual) NewTimer(d time.Duration) *Timer {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var e *event
+	if d <= 0 {
+		e = &event{ch: make(chan time.Time, 1), index: -1, fired: true}
+		v.active++
+		e.ch <- v.now
+	} else {
+		e = v.schedule(d)
+	}
+
+	done := false
+	return &Timer{C: e.ch, done: func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if done {
+			return
+		}
+		done = true
+		if e.index >= 0 {
+			heap.Remove(&v.events, e.index)
+		} else if e.fired {
+			v.release()
+		}
+	}}
+}
+
+func (v *Virtual) run() {
+	for {
+		v.mu.Lock()
+		if len(v.events) == 0 || v.active > 0 {
+			pending, active := len(v.events), v.active
+			v.mu.Unlock()
+			select {
+			case <-v.wake:
+			case <-time.After(StuckWarning):
+				if pending > 0 {
+					slog.Warn("Reloj virtual detenido: hay trabajos en curso que no se soltaron", "trabajos", active, "eventos", pending)
+				}
+			}
+			continue
+		}
+
+		e := heap.Pop(&v.events).(*event)
+		if e.deadline.After(v.now) {
+			v.now = e.deadline
+		}
+		e.fired = true
+		v.active++ // el de quien atiende el evento
+		e.ch <- v.now
+		v.mu.Unlock()
+	}
+}
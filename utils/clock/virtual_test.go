@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// work simula trabajo que tarda en tiempo real más que lo que tarda el sistema en registrar un evento.
+const work = 30 * time.Millisecond
+
+// runScenario corre varios actores sobre un reloj virtual nuevo y devuelve lo que registró cada uno,
+// con el instante virtual de cada paso.
+func runScenario(t *testing.T) map[string][]string {
+	v := NewVirtual(Epoch)
+	Use(v)
+	defer Use(realClock{})
+
+	var mu sync.Mutex
+	trace := make(map[string][]string)
+	record := func(actor string, step string) {
+		mu.Lock()
+		defer mu.Unlock()
+		trace[actor] = append(trace[actor], fmt.Sprintf("%v %s", Since(Epoch), step))
+	}
+
+	var wg sync.WaitGroup
+	spawn := func(actor string, body func()) {
+		wg.Add(1)
+		Hold()
+		go func() {
+			defer wg.Done()
+			defer Release()
+			body()
+			record(actor, "fin")
+		}()
+	}
+
+	var shared Mutex
+
+	spawn("A", func() {
+		Sleep(10 * time.Millisecond)
+		shared.Lock()
+		record("A", "lock")
+		time.Sleep(work)
+		Sleep(20 * time.Millisecond)
+		record("A", "unlock")
+		shared.Unlock()
+		Sleep(5 * time.Millisecond)
+	})
+	spawn("B", func() {
+		Sleep(15 * time.Millisecond)
+		record("B", "espera")
+		time.Sleep(work)
+		shared.Lock()
+		record("B", "lock")
+		Sleep(10 * time.Millisecond)
+		shared.Unlock()
+	})
+	spawn("C", func() {
+		for i := range 3 {
+			time.Sleep(work)
+			Sleep(12 * time.Millisecond)
+			record("C", fmt.Sprint("paso ", i))
+		}
+	})
+
+	timer := NewTimer(25 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-timer.C
+		record("timer", "vence")
+		time.Sleep(work)
+		record("timer", "atendido")
+		timer.Done()
+	}()
+
+	wg.Wait()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.active != 0 {
+		t.Errorf("quedaron %d trabajos sin soltar", v.active)
+	}
+	return trace
+}
+
+func TestVirtualIsDeterministic(t *testing.T) {
+	first := runScenario(t)
+	second := runScenario(t)
+
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("dos corridas del mismo escenario difieren:\n%v\n%v", first, second)
+	}
+
+	want := map[string][]string{
+		"A":     {"10ms lock", "30ms unlock", "35ms fin"},
+		"B":     {"15ms espera", "30ms lock", "40ms fin"},
+		"C":     {"12ms paso 0", "24ms paso 1", "36ms paso 2", "36ms fin"},
+		"timer": {"25ms vence", "25ms atendido"},
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Fatalf("traza inesperada:\n got %v\nwant %v", first, want)
+	}
+}
@@ -1,5 +1,13 @@
 package codeutils
 
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
 type Opcode int
 
 type Instruction struct {
@@ -16,6 +24,26 @@ const (
 	IO
 	INIT_PROC
 	DUMP_MEMORY
+	WAIT
+	SIGNAL
+	THREAD_CREATE
+	THREAD_JOIN
+	THREAD_EXIT
+	WAIT_CHILD
+	SLEEP
+	MSG_SEND
+	MSG_RECV
+	SHM_ATTACH
+	SHM_DETACH
+	MALLOC
+	F_CREATE
+	F_OPEN
+	F_WRITE
+	F_READ
+	F_TRUNCATE
+	F_DELETE
+	IO_STDOUT
+	IO_STDIN
 )
 
 var OpcodeStrings map[Opcode]string = map[Opcode]string{
@@ -27,6 +55,30 @@ var OpcodeStrings map[Opcode]string = map[Opcode]string{
 	IO:          "IO",
 	INIT_PROC:   "INIT_PROC",
 	DUMP_MEMORY: "DUMP_MEMORY",
+	WAIT:        "WAIT",
+	SIGNAL:      "SIGNAL",
+
+	THREAD_CREATE: "THREAD_CREATE",
+	THREAD_JOIN:   "THREAD_JOIN",
+	THREAD_EXIT:   "THREAD_EXIT",
+
+	WAIT_CHILD: "WAIT_CHILD",
+	SLEEP:      "SLEEP",
+	MSG_SEND:   "MSG_SEND",
+	MSG_RECV:   "MSG_RECV",
+	SHM_ATTACH: "SHM_ATTACH",
+	SHM_DETACH: "SHM_DETACH",
+	MALLOC:     "MALLOC",
+
+	F_CREATE:   "F_CREATE",
+	F_OPEN:     "F_OPEN",
+	F_WRITE:    "F_WRITE",
+	F_READ:     "F_READ",
+	F_TRUNCATE: "F_TRUNCATE",
+	F_DELETE:   "F_DELETE",
+
+	IO_STDOUT: "IO_STDOUT",
+	IO_STDIN:  "IO_STDIN",
 }
 
 func OpCodeFromString(str string) Opcode {
@@ -37,3 +89,93 @@ func OpCodeFromString(str string) Opcode {
 	}
 	return -1
 }
+
+// arity es la cantidad de argumentos que acepta una instrucción, de min a max.
+type arity struct{ min, max int }
+
+var arities = map[Opcode]arity{
+	NOOP:        {0, 0},
+	EXIT:        {0, 0},
+	WRITE:       {2, 2}, // WRITE <dirección> <datos>
+	READ:        {2, 2}, // READ <dirección> <tamaño>
+	GOTO:        {1, 1},
+	IO:          {2, 2}, // IO <dispositivo> <tiempo>
+	INIT_PROC:   {2, 3}, // INIT_PROC <archivo> <tamaño> [prioridad]
+	DUMP_MEMORY: {0, 0},
+	WAIT:        {1, 1},
+	SIGNAL:      {1, 1},
+
+	THREAD_CREATE: {1, 2}, // THREAD_CREATE <archivo> [prioridad]
+	THREAD_JOIN:   {1, 1},
+	THREAD_EXIT:   {0, 0},
+
+	WAIT_CHILD: {0, 1},
+	SLEEP:      {1, 1},
+	MSG_SEND:   {3, 3}, // MSG_SEND <cola> <dirección> <tamaño>
+	MSG_RECV:   {3, 3}, // MSG_RECV <cola> <dirección> <tamaño>
+	SHM_ATTACH: {2, 3}, // SHM_ATTACH <nombre> <tamaño> [destino]
+	SHM_DETACH: {1, 1},
+	MALLOC:     {1, 2}, // MALLOC <tamaño> [destino]
+
+	F_CREATE:   {1, 1},
+	F_OPEN:     {1, 1},
+	F_WRITE:    {4, 4}, // F_WRITE <archivo> <dirección> <tamaño> <desplazamiento>
+	F_READ:     {4, 4}, // F_READ <archivo> <dirección> <tamaño> <desplazamiento>
+	F_TRUNCATE: {2, 2}, // F_TRUNCATE <archivo> <tamaño>
+	F_DELETE:   {1, 1},
+
+	IO_STDOUT: {3, 3}, // IO_STDOUT <dispositivo> <dirección> <tamaño>
+	IO_STDIN:  {3, 3}, // IO_STDIN <dispositivo> <dirección> <tamaño>
+}
+
+// ValidateArgs verifica que la instrucción tenga la cantidad de argumentos que acepta su opcode.
+func ValidateArgs(inst Instruction) error {
+	expected, exists := arities[inst.Opcode]
+	if !exists {
+		return fmt.Errorf("opcode %d not recognized", inst.Opcode)
+	}
+	if len(inst.Args) < expected.min || len(inst.Args) > expected.max {
+		if expected.min == expected.max {
+			return fmt.Errorf("%s expects %d arguments, got %d", OpcodeStrings[inst.Opcode], expected.min, len(inst.Args))
+		}
+		return fmt.Errorf("%s expects %d to %d arguments, got %d", OpcodeStrings[inst.Opcode], expected.min, expected.max, len(inst.Args))
+	}
+	return nil
+}
+
+/*
+Dirección devuelta por MALLOC y SHM_ATTACH.
+
+Las dos syscalls aceptan como último argumento opcional una dirección lógica del proceso (el destino). Ahí el kernel escribe
+la dirección lógica asignada, en decimal completada con ceros a la izquierda hasta ResultSize bytes, antes de que el
+proceso vuelva a ejecutar: enseguida, o con un MALLOC que se bloqueó esperando memoria, antes de pasarlo a READY.
+El programa la puede leer con READ <destino> 10 o mostrar con IO_STDOUT. Sin destino la dirección solo se loguea.
+*/
+const ResultSize = 10
+
+// FormatResult arma lo que se escribe en el destino de una syscall que devuelve una dirección.
+func FormatResult(address int) []byte {
+	return []byte(fmt.Sprintf("%0*d", ResultSize, address))
+}
+
+// ErrInvalidCode envuelve los errores de ParseCode, para distinguir un programa mal escrito de otras fallas.
+var ErrInvalidCode = errors.New("invalid code")
+
+// ParseCode lee un programa de pseudocódigo, una instrucción por línea con sus argumentos separados por espacios.
+func ParseCode(codeFile io.Reader) ([]Instruction, error) {
+	code := make([]Instruction, 0)
+	scanner := bufio.NewScanner(codeFile)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), " ")
+		opcode := OpCodeFromString(parts[0])
+		if opcode == -1 {
+			return nil, fmt.Errorf("%w: line %d: opcode %q not recognized", ErrInvalidCode, len(code)+1, parts[0])
+		}
+		instruction := Instruction{Opcode: opcode, Args: parts[1:]}
+		if err := ValidateArgs(instruction); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidCode, len(code)+1, err)
+		}
+		code = append(code, instruction)
+	}
+	return code, scanner.Err()
+}
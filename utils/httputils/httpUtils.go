@@ -2,6 +2,7 @@ package httputils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net"
@@ -69,3 +70,12 @@ func BuildUrl(data URLData) string {
 	}
 	return url
 }
+
+// WriteJSON responde con value serializado como JSON.
+func WriteJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Error serializando respuesta JSON", "error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package memoryutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"ssoo-utils/httputils"
+)
+
+// SharedHeader lo agrega memoria en /frame cuando otra CPU puede estar usando el mismo marco: páginas de un
+// segmento compartido o de un proceso con hilos. La CPU no guarda esas páginas en la TLB ni en la caché.
+const SharedHeader = "X-Shared-Page"
+
+// Client lee y escribe la memoria lógica de un proceso con /logical_memory de memoria.
+// El PID es el de memoria (el del proceso, no el de un hilo) y las direcciones son lógicas.
+type Client struct {
+	Ip   string
+	Port int
+}
+
+func (c Client) Read(pid uint, address int, size int) ([]byte, error) {
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       c.Ip,
+		Port:     c.Port,
+		Endpoint: "logical_memory",
+		Queries: map[string]string{
+			"pid":     fmt.Sprint(pid),
+			"address": fmt.Sprint(address),
+			"size":    fmt.Sprint(size),
+		},
+	})
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error al llamar a Memoria: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("memoria rechazó la lectura (código %d): %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (c Client) Write(pid uint, address int, data []byte) error {
+	url := httputils.BuildUrl(httputils.URLData{
+		Ip:       c.Ip,
+		Port:     c.Port,
+		Endpoint: "logical_memory",
+		Queries: map[string]string{
+			"pid":     fmt.Sprint(pid),
+			"address": fmt.Sprint(address),
+		},
+	})
+
+	resp, err := http.Post(url, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error al llamar a Memoria: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("memoria rechazó la escritura (código %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
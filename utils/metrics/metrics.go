@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Registro de métricas compartido por todos los módulos.
+
+Cada módulo declara sus métricas como variables de paquete (NewCounter, NewGauge, ...)
+y las expone con Handler en /metrics, en el formato de texto de Prometheus.
+*/
+
+type collector interface {
+	write(sb *strings.Builder)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	names      []string
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default es el registro usado por las funciones de paquete.
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collectors[name]; exists {
+		panic("métrica registrada dos veces: " + name)
+	}
+	r.names = append(r.names, name)
+	r.collectors[name] = c
+}
+
+// Expose devuelve todas las métricas en el formato de texto de Prometheus.
+func (r *Registry) Expose() string {
+	r.mu.Lock()
+	names := slices.Clone(r.names)
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		r.collectors[name].write(&sb)
+	}
+	return sb.String()
+}
+
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.Expose()))
+	}
+}
+
+func Handler() http.HandlerFunc { return Default.Handler() }
+
+// #region VALUES
+
+// value es un float64 que se actualiza de forma atómica.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) Load() float64 { return math.Float64frombits(v.bits.Load()) }
+
+func (v *value) Store(f float64) { v.bits.Store(math.Float64bits(f)) }
+
+func (v *value) Add(delta float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Counter solo puede crecer.
+type Counter struct{ value }
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("un contador no puede decrecer")
+	}
+	c.value.Add(delta)
+}
+
+type Gauge struct{ value }
+
+func (g *Gauge) Set(f float64) { g.Store(f) }
+
+func (g *Gauge) Add(delta float64) { g.value.Add(delta) }
+
+// #endregion
+
+// #region COLLECTORS
+
+type header struct {
+	name, help, kind string
+}
+
+func (h header) writeHeader(sb *strings.Builder) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", h.name, h.help, h.name, h.kind)
+}
+
+func writeSample(sb *strings.Builder, name string, labels []string, values []string, v float64) {
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(sb, "%s=%q", label, values[i])
+		}
+		sb.WriteByte('}')
+	}
+	fmt.Fprintf(sb, " %v\n", v)
+}
+
+type single struct {
+	header
+	v *value
+}
+
+func (s single) write(sb *strings.Builder) {
+	s.writeHeader(sb)
+	writeSample(sb, s.name, nil, nil, s.v.Load())
+}
+
+type gaugeFunc struct {
+	header
+	fn func() float64
+}
+
+func (g gaugeFunc) write(sb *strings.Builder) {
+	g.writeHeader(sb)
+	writeSample(sb, g.name, nil, nil, g.fn())
+}
+
+type gaugeVecFunc struct {
+	header
+	label string
+	fn    func() map[string]float64
+}
+
+func (g gaugeVecFunc) write(sb *strings.Builder) {
+	g.writeHeader(sb)
+	samples := g.fn()
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(sb, g.name, []string{g.label}, []string{key}, samples[key])
+	}
+}
+
+// vec agrupa una métrica por los valores de sus etiquetas.
+type vec[T any] struct {
+	header
+	labels []string
+	mu     sync.Mutex
+	keys   []string
+	values map[string]*T
+	load   func(*T) float64
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("la métrica %s espera %d etiquetas", v.name, len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	t, ok := v.values[key]
+	if !ok {
+		t = new(T)
+		v.values[key] = t
+		v.keys = append(v.keys, key)
+	}
+	return t
+}
+
+func (v *vec[T]) write(sb *strings.Builder) {
+	v.writeHeader(sb)
+	v.mu.Lock()
+	keys := slices.Clone(v.keys)
+	v.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(sb, v.name, v.labels, strings.Split(key, "\xff"), v.load(v.values[key]))
+	}
+}
+
+type CounterVec struct{ vec *vec[Counter] }
+
+func (c *CounterVec) With(values ...string) *Counter { return c.vec.with(values...) }
+
+type GaugeVec struct{ vec *vec[Gauge] }
+
+func (g *GaugeVec) With(values ...string) *Gauge { return g.vec.with(values...) }
+
+// #endregion
+
+// #region CONSTRUCTORS
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := new(Counter)
+	r.register(name, single{header{name, help, "counter"}, &c.value})
+	return c
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := new(Gauge)
+	r.register(name, single{header{name, help, "gauge"}, &g.value})
+	return g
+}
+
+// NewGaugeFunc registra un gauge cuyo valor se calcula en cada lectura.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, gaugeFunc{header{name, help, "gauge"}, fn})
+}
+
+// NewGaugeVecFunc registra un gauge con una etiqueta cuyos valores se calculan en cada lectura.
+func (r *Registry) NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.register(name, gaugeVecFunc{header{name, help, "gauge"}, label, fn})
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &vec[Counter]{header: header{name, help, "counter"}, labels: labels, values: map[string]*Counter{},
+		load: func(c *Counter) float64 { return c.Load() }}
+	r.register(name, v)
+	return &CounterVec{v}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &vec[Gauge]{header: header{name, help, "gauge"}, labels: labels, values: map[string]*Gauge{},
+		load: func(g *Gauge) float64 { return g.Load() }}
+	r.register(name, v)
+	return &GaugeVec{v}
+}
+
+func NewCounter(name, help string) *Counter { return Default.NewCounter(name, help) }
+
+func NewGauge(name, help string) *Gauge { return Default.NewGauge(name, help) }
+
+func NewGaugeFunc(name, help string, fn func() float64) { Default.NewGaugeFunc(name, help, fn) }
+
+func NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	Default.NewGaugeVecFunc(name, help, label, fn)
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// Ratio devuelve hits / (hits + misses), o 0 si todavía no hubo accesos.
+func Ratio(hits, misses *Counter) float64 {
+	total := hits.Load() + misses.Load()
+	if total == 0 {
+		return 0
+	}
+	return hits.Load() / total
+}
+
+// #endregion
@@ -1,8 +1,12 @@
 package pcb
 
 import (
+	"encoding/json"
 	"fmt"
+	"ssoo-utils/clock"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,33 +22,58 @@ const (
 	SUSP_READY
 )
 
+// PCB es seguro para usar desde varias goroutines: el kernel lo lee desde los handlers HTTP
+// mientras la ProcessTable le cambia el estado.
 type PCB struct {
-	pid          uint
+	mu           sync.Mutex
+	pid          uint // no cambia después de Create
 	state        STATE
 	pc           int
 	k_metrics    kernel_metrics
 	codeFilePath string
 }
 
-func (pcb PCB) GetPID() uint    { return pcb.pid }
-func (pcb PCB) GetState() STATE { return pcb.state }
-func (pcb PCB) GetPC() int      { return pcb.pc }
+func (pcb *PCB) GetPID() uint { return pcb.pid }
+
+func (pcb *PCB) GetState() STATE {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
+	return pcb.state
+}
+
+func (pcb *PCB) GetPC() int {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
+	return pcb.pc
+}
+
 func (pcb *PCB) SetPC(pc int) {
 	if pc < 0 {
 		panic("PC cannot be negative")
 	}
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
 	pcb.pc = pc
 }
 
 // Probably not necessary as their only use will be for logging at the end
 // That being the case, the only necessary exposed function is to format them to string/json
-func (pcb PCB) GetKernelMetrics() kernel_metrics { return pcb.k_metrics }
+func (pcb *PCB) GetKernelMetrics() kernel_metrics {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
+	metrics := pcb.k_metrics
+	metrics.Sequence_list = slices.Clone(metrics.Sequence_list)
+	metrics.Instants_list = slices.Clone(metrics.Instants_list)
+	metrics.Details_list = slices.Clone(metrics.Details_list)
+	return metrics
+}
 
 // Exposing the values on this structs is only temporary, as they lack meaning without format.
 // Same as previous commentary, the only necessary exposed function is the formatting function.
 type kernel_metrics struct {
 	Sequence_list []STATE
 	Instants_list []time.Time
+	Details_list  []string // CPU o dispositivo asociado a cada transición, si corresponde
 	Frequency     [7]int
 	Time_spent    [7]time.Duration
 }
@@ -58,10 +87,13 @@ func Create(pid uint, path string) *PCB {
 }
 
 func (pcb *PCB) SetState(newState STATE) {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
 	pcb.state = newState
 	metrics := &pcb.k_metrics
 	metrics.Sequence_list = append(metrics.Sequence_list, newState)
-	metrics.Instants_list = append(metrics.Instants_list, time.Now())
+	metrics.Instants_list = append(metrics.Instants_list, clock.Now())
+	metrics.Details_list = append(metrics.Details_list, "")
 
 	if pcb.state == NEW {
 		metrics.Frequency[newState] = 1
@@ -75,6 +107,27 @@ func (pcb *PCB) SetState(newState STATE) {
 	}
 }
 
+// StateSince devuelve el instante en el que el proceso entró a su estado actual.
+func (pcb *PCB) StateSince() time.Time {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
+	instants := pcb.k_metrics.Instants_list
+	if len(instants) == 0 {
+		return time.Time{}
+	}
+	return instants[len(instants)-1]
+}
+
+// SetStateDetail asocia un detalle (CPU, dispositivo de IO) a la última transición de estado.
+func (pcb *PCB) SetStateDetail(detail string) {
+	pcb.mu.Lock()
+	defer pcb.mu.Unlock()
+	details := pcb.k_metrics.Details_list
+	if len(details) > 0 {
+		details[len(details)-1] = detail
+	}
+}
+
 func (s STATE) String() string {
 	states := [...]string{"EXIT", "NEW", "READY", "EXEC", "BLOCKED", "SUSP_BLOCKED", "SUSP_READY"}
 	if s < 0 || int(s) >= len(states) {
@@ -90,3 +143,29 @@ func (k kernel_metrics) String() string {
 	}
 	return sb.String()
 }
+
+type stateChange struct {
+	State   string    `json:"state"`
+	Instant time.Time `json:"instant"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+func (k kernel_metrics) MarshalJSON() ([]byte, error) {
+	history := make([]stateChange, len(k.Sequence_list))
+	for i, state := range k.Sequence_list {
+		history[i] = stateChange{State: state.String(), Instant: k.Instants_list[i], Detail: k.Details_list[i]}
+	}
+
+	frequency := make(map[string]int, len(k.Frequency))
+	timeSpent := make(map[string]int64, len(k.Time_spent))
+	for i := range k.Frequency {
+		frequency[STATE(i).String()] = k.Frequency[i]
+		timeSpent[STATE(i).String()] = k.Time_spent[i].Milliseconds()
+	}
+
+	return json.Marshal(struct {
+		History     []stateChange    `json:"history"`
+		Frequency   map[string]int   `json:"frequency"`
+		TimeSpentMs map[string]int64 `json:"time_spent_ms"`
+	}{history, frequency, timeSpent})
+}